@@ -0,0 +1,142 @@
+package unitycloudbuild
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const BuildManifestFilename = "build-manifest.json"
+
+// BuildManifest records which build was downloaded into a directory. It is
+// written to BuildManifestFilename when DownloadOptions.Manifest is set.
+type BuildManifest struct {
+	TargetId     string           `json:"buildTargetId"`
+	BuildNumber  int              `json:"build"`
+	GUID         string           `json:"buildGUID"`
+	Revision     string           `json:"lastBuiltRevision,omitempty"`
+	UnityVersion string           `json:"unityVersion"`
+	Platform     string           `json:"platform"`
+	Artifact     string           `json:"artifact,omitempty"`
+	Downloaded   time.Time        `json:"downloaded"`
+	Downloads    []DownloadedFile `json:"downloads"`
+
+	// Files lists every file written by the download, either saved or
+	// extracted. Other files in the output directory are not included.
+	Files []ManifestFile `json:"files"`
+}
+
+type ManifestFile struct {
+	// Path is relative to the output directory, using forward slashes.
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"`
+
+	// Link is the target of a symlink, which has no checksum.
+	Link string `json:"link,omitempty"`
+}
+
+// writeBuildManifest hashes the files written by the downloads and writes the
+// manifest next to them in outputDir.
+func writeBuildManifest(outputDir string, build *Build, artifact string, downloaded []DownloadedFile) (string, error) {
+	manifest := BuildManifest{
+		TargetId:     build.TargetId,
+		BuildNumber:  build.Number,
+		GUID:         build.GUID,
+		Revision:     build.LastBuiltRevision,
+		UnityVersion: build.UnityVersion,
+		Platform:     build.Platform,
+		Artifact:     artifact,
+		Downloaded:   time.Now().UTC(),
+		Downloads:    downloaded,
+	}
+
+	var written []string
+	for _, download := range downloaded {
+		written = append(written, download.written...)
+	}
+
+	var err error
+	if manifest.Files, err = hashFiles(outputDir, written); err != nil {
+		return "", err
+	}
+
+	b, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return "", err
+	}
+
+	// Write to a temp file first so that a manifest is never half written
+	filename := filepath.Join(outputDir, BuildManifestFilename)
+	if err := ioutil.WriteFile(filename+".tmp", append(b, '\n'), 0644); err != nil {
+		return "", err
+	}
+
+	return filename, os.Rename(filename+".tmp", filename)
+}
+
+// hashFiles returns the SHA-256 of each of paths, relative to dir and sorted
+// by path. A path written more than once is listed once.
+func hashFiles(dir string, paths []string) ([]ManifestFile, error) {
+	var files []ManifestFile
+	seen := make(map[string]bool)
+
+	for _, path := range paths {
+		rel := filepath.ToSlash(relPath(dir, path))
+		if seen[rel] {
+			continue
+		}
+		seen[rel] = true
+
+		info, err := os.Lstat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		file := ManifestFile{Path: rel, Size: info.Size()}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			if err != nil {
+				return nil, err
+			}
+			file.Link = filepath.ToSlash(link)
+			file.Size = 0
+		} else if info.Mode().IsRegular() {
+			if file.SHA256, err = hashFile(path); err != nil {
+				return nil, err
+			}
+		} else {
+			continue
+		}
+
+		files = append(files, file)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	return files, nil
+}
+
+func hashFile(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
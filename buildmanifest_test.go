@@ -0,0 +1,58 @@
+package unitycloudbuild
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteBuildManifestListsWrittenFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	for name, content := range map[string]string{"existing.txt": "old", "Game/Game.exe": "binary", "Game.zip": "zip"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		} else if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("Game.exe", filepath.Join(dir, "Game/Current")); err != nil {
+		t.Fatal(err)
+	}
+
+	downloaded := []DownloadedFile{
+		{Filename: "Game.zip", Action: DownloadAction_Extracted, written: []string{filepath.Join(dir, "Game/Game.exe"), filepath.Join(dir, "Game/Current")}},
+		{Filename: "Game.zip", Action: DownloadAction_Saved, written: []string{filepath.Join(dir, "Game.zip"), filepath.Join(dir, "Game/Game.exe")}},
+	}
+
+	filename, err := writeBuildManifest(dir, &Build{TargetId: "windows", Number: 1}, "", downloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest BuildManifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []ManifestFile{
+		{Path: "Game.zip", Size: 3, SHA256: "4a70fe9aa6436e02c2dea340fbd1e352e4ef2d8ce6ca52ad25d4b95471fc8bf2"},
+		{Path: "Game/Current", Link: "Game.exe"},
+		{Path: "Game/Game.exe", Size: 6, SHA256: "9a3a45d01531a20e89ac6ae10b0b0beb0492acd7216a368aa062d1a5fecaf9cd"},
+	}
+	if len(manifest.Files) != len(expected) {
+		t.Fatalf("Expected %d files, got %+v", len(expected), manifest.Files)
+	}
+	for i, file := range manifest.Files {
+		if file != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], file)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package unitycloudbuild
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const cacheEntryFilename = "entry.json"
+
+// DownloadCache stores downloaded build files on disk, keyed by target, build
+// number and build GUID, so that the same build is only downloaded once.
+type DownloadCache struct {
+	Dir string
+}
+
+// DefaultCacheDir returns the unity-cb-tool directory in the user's cache
+// directory, e.g. ~/.cache/unity-cb-tool on Linux.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "unity-cb-tool"), nil
+}
+
+// NewDownloadCache creates dir if needed. If dir is empty DefaultCacheDir is
+// used.
+func NewDownloadCache(dir string) (*DownloadCache, error) {
+	if len(dir) == 0 {
+		var err error
+		if dir, err = DefaultCacheDir(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &DownloadCache{Dir: dir}, nil
+}
+
+// CacheEntry is a cached build with the files downloaded for it.
+type CacheEntry struct {
+	TargetId    string       `json:"buildTargetId"`
+	BuildNumber int          `json:"build"`
+	GUID        string       `json:"buildGUID"`
+	Files       []CachedFile `json:"files"`
+	Created     time.Time    `json:"created"`
+	LastUsed    time.Time    `json:"lastUsed"`
+	Dir         string       `json:"dir"`
+}
+
+type CachedFile struct {
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+}
+
+func (e CacheEntry) Size() int64 {
+	var size int64
+	for _, file := range e.Files {
+		size += file.Size
+	}
+	return size
+}
+
+// CacheSize summarizes the contents of a DownloadCache.
+type CacheSize struct {
+	Dir     string `json:"dir"`
+	Entries int    `json:"entries"`
+	Files   int    `json:"files"`
+	Size    int64  `json:"size"`
+}
+
+func (d *DownloadCache) entryDir(build *Build) string {
+	return filepath.Join(d.Dir, url.PathEscape(build.TargetId), fmt.Sprintf("%d-%s", build.Number, url.PathEscape(build.GUID)))
+}
+
+func (d *DownloadCache) path(build *Build, filename string) string {
+	return filepath.Join(d.entryDir(build), filepath.Base(filename))
+}
+
+func readCacheEntry(dir string) (*CacheEntry, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, cacheEntryFilename))
+	if err != nil {
+		return nil, err
+	}
+
+	var entry CacheEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return nil, &DecodeError{Body: b, Err: err}
+	}
+	entry.Dir = dir
+
+	return &entry, nil
+}
+
+func writeCacheEntry(entry *CacheEntry) error {
+	b, err := json.MarshalIndent(entry, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	filename := filepath.Join(entry.Dir, cacheEntryFilename)
+	if err := ioutil.WriteFile(filename+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(filename+".tmp", filename)
+}
+
+// lookup returns the path of a cached file if it exists and still matches the
+// size and SHA-256 recorded when it was stored.
+func (d *DownloadCache) lookup(build *Build, filename string) (string, bool) {
+	if len(build.GUID) == 0 {
+		return "", false
+	}
+
+	entry, err := readCacheEntry(d.entryDir(build))
+	if err != nil || entry.GUID != build.GUID {
+		return "", false
+	}
+
+	cachedPath := d.path(build, filename)
+
+	for _, file := range entry.Files {
+		if file.Filename != filepath.Base(filename) {
+			continue
+		}
+
+		if info, err := os.Stat(cachedPath); err != nil || info.Size() != file.Size {
+			return "", false
+		}
+		if sum, err := hashFile(cachedPath); err != nil || sum != file.SHA256 {
+			return "", false
+		}
+
+		entry.LastUsed = time.Now().UTC()
+		writeCacheEntry(entry)
+
+		return cachedPath, true
+	}
+
+	return "", false
+}
+
+// store records a file that was downloaded to d.path(build, filename).
+func (d *DownloadCache) store(build *Build, filename string) error {
+	dir := d.entryDir(build)
+	cachedPath := d.path(build, filename)
+
+	info, err := os.Stat(cachedPath)
+	if err != nil {
+		return err
+	}
+
+	sum, err := hashFile(cachedPath)
+	if err != nil {
+		return err
+	}
+
+	entry, err := readCacheEntry(dir)
+	if err != nil {
+		now := time.Now().UTC()
+		entry = &CacheEntry{
+			TargetId:    build.TargetId,
+			BuildNumber: build.Number,
+			GUID:        build.GUID,
+			Created:     now,
+			LastUsed:    now,
+			Dir:         dir,
+		}
+	}
+
+	file := CachedFile{Filename: filepath.Base(filename), Size: info.Size(), SHA256: sum}
+
+	replaced := false
+	for i := range entry.Files {
+		if entry.Files[i].Filename == file.Filename {
+			entry.Files[i] = file
+			replaced = true
+		}
+	}
+	if !replaced {
+		entry.Files = append(entry.Files, file)
+	}
+
+	return writeCacheEntry(entry)
+}
+
+// List returns the cached builds, most recently used first.
+func (d *DownloadCache) List() ([]CacheEntry, error) {
+	targetDirs, err := ioutil.ReadDir(d.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []CacheEntry
+	for _, targetDir := range targetDirs {
+		if !targetDir.IsDir() {
+			continue
+		}
+
+		buildDirs, err := ioutil.ReadDir(filepath.Join(d.Dir, targetDir.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, buildDir := range buildDirs {
+			// Directories without an entry are downloads that never completed
+			entry, err := readCacheEntry(filepath.Join(d.Dir, targetDir.Name(), buildDir.Name()))
+			if err != nil {
+				continue
+			}
+			entries = append(entries, *entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+
+	return entries, nil
+}
+
+// Size returns the number of cached builds and files, and their total size.
+func (d *DownloadCache) Size() (*CacheSize, error) {
+	entries, err := d.List()
+	if err != nil {
+		return nil, err
+	}
+
+	size := &CacheSize{Dir: d.Dir, Entries: len(entries)}
+	for _, entry := range entries {
+		size.Files += len(entry.Files)
+		size.Size += entry.Size()
+	}
+
+	return size, nil
+}
+
+// Prune removes builds that have not been used for longer than olderThan and
+// returns them.
+func (d *DownloadCache) Prune(olderThan time.Duration) ([]CacheEntry, error) {
+	entries, err := d.List()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+
+	var pruned []CacheEntry
+	for _, entry := range entries {
+		if entry.LastUsed.After(cutoff) {
+			continue
+		}
+
+		if err := os.RemoveAll(entry.Dir); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, entry)
+
+		// Remove the target directory once its last build is gone
+		os.Remove(filepath.Dir(entry.Dir))
+	}
+
+	return pruned, nil
+}
+
+func copyFile(source string, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
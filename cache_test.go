@@ -0,0 +1,200 @@
+package unitycloudbuild
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// storeTestFile downloads content for build into the cache, the way
+// downloadFile does.
+func storeTestFile(t *testing.T, cache *DownloadCache, build *Build, filename string, content []byte) string {
+	t.Helper()
+
+	path := cache.path(build, filename)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.store(build, filename); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// setLastUsed changes when the entry of build was last used.
+func setLastUsed(t *testing.T, cache *DownloadCache, build *Build, lastUsed time.Time) {
+	t.Helper()
+
+	entry, err := readCacheEntry(cache.entryDir(build))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.LastUsed = lastUsed
+	if err := writeCacheEntry(entry); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDownloadCacheLookup(t *testing.T) {
+	cache, err := NewDownloadCache(filepath.Join(t.TempDir(), "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	build := &Build{TargetId: "android", Number: 3, GUID: "0b5e1ad2"}
+	content := testContent(1000)
+	path := storeTestFile(t, cache, build, "build.zip", content)
+
+	t.Run("hit", func(t *testing.T) {
+		setLastUsed(t, cache, build, time.Now().Add(-time.Hour))
+
+		cachedPath, ok := cache.lookup(build, "build.zip")
+		if !ok || cachedPath != path {
+			t.Fatalf("Expected %s to be found, got %s", path, cachedPath)
+		}
+
+		entry, err := readCacheEntry(cache.entryDir(build))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if time.Since(entry.LastUsed) > time.Minute {
+			t.Errorf("Expected the entry to be marked as used, last used %v", entry.LastUsed)
+		}
+		if len(entry.Files) != 1 || entry.Files[0].Size != 1000 || entry.Files[0].SHA256 != sha256Hex(content) {
+			t.Errorf("Expected the size and SHA-256 of the file to be stored, got %+v", entry.Files)
+		}
+	})
+
+	misses := map[string]struct {
+		Build    *Build
+		Filename string
+	}{
+		"other file":   {build, "symbols.zip"},
+		"other build":  {&Build{TargetId: "android", Number: 4, GUID: "0b5e1ad2"}, "build.zip"},
+		"other guid":   {&Build{TargetId: "android", Number: 3, GUID: "f00d"}, "build.zip"},
+		"missing guid": {&Build{TargetId: "android", Number: 3}, "build.zip"},
+	}
+	for name, tc := range misses {
+		t.Run(name, func(t *testing.T) {
+			if cachedPath, ok := cache.lookup(tc.Build, tc.Filename); ok {
+				t.Errorf("Expected no cached file, got %s", cachedPath)
+			}
+		})
+	}
+
+	t.Run("sha256 mismatch", func(t *testing.T) {
+		// Same size, different content
+		changed := append([]byte(nil), content...)
+		changed[500]++
+		if err := ioutil.WriteFile(path, changed, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := cache.lookup(build, "build.zip"); ok {
+			t.Error("Expected a modified file not to be used")
+		}
+	})
+
+	t.Run("size mismatch", func(t *testing.T) {
+		if err := ioutil.WriteFile(path, content[:999], 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := cache.lookup(build, "build.zip"); ok {
+			t.Error("Expected a truncated file not to be used")
+		}
+	})
+
+	t.Run("store again", func(t *testing.T) {
+		storeTestFile(t, cache, build, "build.zip", content)
+		storeTestFile(t, cache, build, "symbols.zip", content[:10])
+
+		entry, err := readCacheEntry(cache.entryDir(build))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entry.Files) != 2 || entry.Size() != 1010 {
+			t.Errorf("Expected the file to be replaced and another added, got %+v", entry.Files)
+		}
+		if _, ok := cache.lookup(build, "build.zip"); !ok {
+			t.Error("Expected the stored file to be found again")
+		}
+	})
+}
+
+func TestDownloadCacheListSizePrune(t *testing.T) {
+	cache, err := NewDownloadCache(filepath.Join(t.TempDir(), "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := &Build{TargetId: "android", Number: 1, GUID: "a1"}
+	recent := &Build{TargetId: "android", Number: 2, GUID: "a2"}
+	other := &Build{TargetId: "ios", Number: 7, GUID: "i7"}
+
+	storeTestFile(t, cache, old, "build.zip", testContent(100))
+	storeTestFile(t, cache, recent, "build.zip", testContent(200))
+	storeTestFile(t, cache, recent, "symbols.zip", testContent(50))
+	storeTestFile(t, cache, other, "build.ipa", testContent(300))
+
+	setLastUsed(t, cache, old, time.Now().Add(-60*24*time.Hour))
+	setLastUsed(t, cache, recent, time.Now().Add(-time.Hour))
+	setLastUsed(t, cache, other, time.Now().Add(-40*24*time.Hour))
+
+	// A download that never completed has no entry
+	if err := os.MkdirAll(cache.entryDir(&Build{TargetId: "android", Number: 3, GUID: "a3"}), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := cache.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, entry := range entries {
+		ids = append(ids, (&Build{TargetId: entry.TargetId, Number: entry.BuildNumber}).UniqueId())
+	}
+	if len(ids) != 3 || ids[0] != "android-#2" || ids[1] != "ios-#7" || ids[2] != "android-#1" {
+		t.Errorf("Expected builds most recently used first, got %v", ids)
+	}
+
+	size, err := cache.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *size != (CacheSize{Dir: cache.Dir, Entries: 3, Files: 4, Size: 650}) {
+		t.Errorf("Unexpected size %+v", size)
+	}
+
+	pruned, err := cache.Prune(30 * 24 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 2 || pruned[0].TargetId != "ios" || pruned[1].BuildNumber != 1 {
+		t.Errorf("Expected ios #7 and android #1 to be pruned, got %+v", pruned)
+	}
+
+	for _, entry := range pruned {
+		if _, err := os.Stat(entry.Dir); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed, got %v", entry.Dir, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cache.Dir, "ios")); !os.IsNotExist(err) {
+		t.Errorf("Expected the empty target directory to be removed, got %v", err)
+	}
+	if _, ok := cache.lookup(recent, "symbols.zip"); !ok {
+		t.Error("Expected the recent build to be kept")
+	}
+}
@@ -0,0 +1,293 @@
+package unitycloudbuild
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const minChunkSize = 4 * 1024 * 1024
+
+type chunk struct {
+	Start int64
+	End   int64 // inclusive
+}
+
+// fetchFileParallel downloads a file using several connections, each
+// fetching a range of the file. It falls back to fetchFile if the server does
+// not support range requests, or if a previous partial download is resumed.
+// As the chunks that completed are not recorded, the .part file is always
+// removed when a parallel download fails, even if resume is set.
+func (c *Client) fetchFileParallel(ctx context.Context, download downloadFile, filename string, connections int, resume bool, progress ProgressFunc) (err error) {
+	partName := filename + ".part"
+
+	if resume {
+		if info, err := os.Stat(partName); err == nil && info.Size() > 0 {
+			return c.fetchFile(ctx, download, filename, resume, progress)
+		}
+	}
+
+	total, etag, err := c.probeRanges(ctx, download)
+	if err != nil {
+		return err
+	} else if total <= minChunkSize {
+		if c.Context.Verbose {
+			log.Printf("Range requests not supported or file is small, using a single connection")
+		}
+		return c.fetchFile(ctx, download, filename, resume, progress)
+	}
+
+	file, err := c.openPartFile(partName)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+		if err != nil {
+			os.Remove(partName)
+		}
+	}()
+
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	if err := file.Truncate(total); err != nil {
+		return err
+	}
+
+	chunks := splitChunks(total, connections)
+	if c.Context.Verbose {
+		log.Printf("Downloading %s in %d chunks using %d connections", download.Filename, len(chunks), connections)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var downloaded int64
+	stopProgress := c.reportProgress(progress, download.Filename, &downloaded, total)
+
+	queue := make(chan chunk, len(chunks))
+	for _, ch := range chunks {
+		queue <- ch
+	}
+	close(queue)
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+
+	for i := 0; i < connections; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ch := range queue {
+				if err := c.fetchChunk(ctx, download, file, ch, &downloaded); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	stopProgress(firstErr == nil)
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	if err := verifyDownload(file, download, total, fetchResult{Total: total, ETag: etag}); err != nil {
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+	file = nil
+
+	return os.Rename(partName, filename)
+}
+
+// probeRanges requests the first byte of the file. If the server answers with
+// a partial response, the total size is returned, otherwise -1.
+func (c *Client) probeRanges(ctx context.Context, download downloadFile) (int64, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", download.URL.String(), nil)
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		m := contentRangeRegex.FindStringSubmatch(resp.Header.Get("Content-Range"))
+		if m == nil || m[2] == "*" {
+			return -1, "", nil
+		}
+		total, _ := strconv.ParseInt(m[2], 10, 64)
+		return total, resp.Header.Get("ETag"), nil
+	case http.StatusOK, http.StatusRequestedRangeNotSatisfiable:
+		return -1, "", nil
+	default:
+		return 0, "", &downloadStatusError{StatusCode: resp.StatusCode}
+	}
+}
+
+// splitChunks divides a file into several chunks per connection so that
+// faster connections pick up more of the work.
+func splitChunks(total int64, connections int) []chunk {
+	size := total / int64(connections*4)
+	if size < minChunkSize {
+		size = minChunkSize
+	}
+
+	var chunks []chunk
+	for start := int64(0); start < total; start += size {
+		end := start + size - 1
+		if end >= total {
+			end = total - 1
+		}
+		chunks = append(chunks, chunk{Start: start, End: end})
+	}
+	return chunks
+}
+
+// fetchChunk downloads a single range into file, retrying and resuming
+// within the range on transient errors.
+func (c *Client) fetchChunk(ctx context.Context, download downloadFile, file *os.File, ch chunk, downloaded *int64) error {
+	offset := ch.Start
+
+	for attempt := 1; ; attempt++ {
+		err := c.fetchChunkOnce(ctx, download, file, chunk{Start: offset, End: ch.End}, &offset, downloaded)
+		if err == nil {
+			return nil
+		}
+
+		var statusErr *downloadStatusError
+		if ctx.Err() != nil || attempt >= c.Retry.MaxAttempts || (errors.As(err, &statusErr) && statusErr.StatusCode < 500) {
+			return err
+		}
+
+		delay := c.Retry.delay(attempt, err)
+		if c.Context.Verbose {
+			log.Printf("Chunk %d-%d interrupted at %d, resuming in %v: %v", ch.Start, ch.End, offset, delay, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (c *Client) fetchChunkOnce(ctx context.Context, download downloadFile, file *os.File, ch chunk, offset *int64, downloaded *int64) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", download.URL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", ch.Start, ch.End))
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return &downloadStatusError{StatusCode: resp.StatusCode}
+	}
+
+	w := &chunkWriter{file: file, offset: offset, downloaded: downloaded}
+	n, err := io.Copy(w, io.LimitReader(resp.Body, ch.End-ch.Start+1))
+	if err != nil {
+		return err
+	} else if n != ch.End-ch.Start+1 {
+		return io.ErrUnexpectedEOF
+	}
+
+	return nil
+}
+
+// chunkWriter writes at *offset in file, advancing it and the shared
+// downloaded counter.
+type chunkWriter struct {
+	file       *os.File
+	offset     *int64
+	downloaded *int64
+}
+
+func (w *chunkWriter) Write(b []byte) (int, error) {
+	n, err := w.file.WriteAt(b, *w.offset)
+	*w.offset += int64(n)
+	atomic.AddInt64(w.downloaded, int64(n))
+	return n, err
+}
+
+// reportProgress periodically reports the shared downloaded counter until the
+// returned function is called.
+func (c *Client) reportProgress(progress ProgressFunc, filename string, downloaded *int64, total int64) func(done bool) {
+	if progress == nil {
+		return func(done bool) {}
+	}
+
+	started := time.Now()
+	report := func(done bool) {
+		p := DownloadProgress{
+			Filename:   filename,
+			Downloaded: atomic.LoadInt64(downloaded),
+			Total:      total,
+			Done:       done,
+		}
+		if elapsed := time.Since(started).Seconds(); elapsed > 0 {
+			p.Rate = float64(p.Downloaded) / elapsed
+		}
+		if p.Rate > 0 {
+			p.ETA = time.Duration(float64(total-p.Downloaded)/p.Rate) * time.Second
+		}
+		progress(p)
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				report(false)
+			}
+		}
+	}()
+
+	return func(done bool) {
+		close(stop)
+		<-stopped
+		if done {
+			report(true)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package unitycloudbuild
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// rangeServer serves content with support for single byte ranges, and
+// records the Range header of every request. If disconnect returns true for
+// a range, only half of it is sent before the connection is closed.
+type rangeServer struct {
+	content    []byte
+	noRanges   bool
+	disconnect func(start int64, end int64) bool
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func (s *rangeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rangeHeader := r.Header.Get("Range")
+
+	s.mu.Lock()
+	s.ranges = append(s.ranges, rangeHeader)
+	s.mu.Unlock()
+
+	if s.noRanges || len(rangeHeader) == 0 {
+		w.Header().Set("Content-Length", strconv.Itoa(len(s.content)))
+		w.Write(s.content)
+		return
+	}
+
+	total := int64(len(s.content))
+	bounds := strings.SplitN(strings.TrimPrefix(rangeHeader, "bytes="), "-", 2)
+	start, _ := strconv.ParseInt(bounds[0], 10, 64)
+	end := total - 1
+	if len(bounds[1]) > 0 {
+		end, _ = strconv.ParseInt(bounds[1], 10, 64)
+	}
+
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, total))
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.WriteHeader(http.StatusPartialContent)
+
+	if s.disconnect != nil && s.disconnect(start, end) {
+		// Returning early with a short body makes the server close the
+		// connection
+		w.Write(s.content[start : start+(end-start+1)/2])
+		return
+	}
+
+	w.Write(s.content[start : end+1])
+}
+
+func (s *rangeServer) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.ranges...)
+}
+
+func fetchParallel(t *testing.T, server *rangeServer, connections int) {
+	t.Helper()
+
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	filename := filepath.Join(t.TempDir(), "build.zip")
+	download := testDownload(t, srv, int64(len(server.content)))
+
+	if err := newTestClient().fetchFileParallel(context.Background(), download, filename, connections, false, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, server.content) {
+		t.Fatalf("Downloaded content does not match")
+	}
+}
+
+func TestFetchFileParallelRanges(t *testing.T) {
+	server := &rangeServer{content: testContent(3*minChunkSize + 1000)}
+	fetchParallel(t, server, 3)
+
+	expected := map[string]bool{
+		"bytes=0-0": true,
+		fmt.Sprintf("bytes=0-%d", minChunkSize-1):                      true,
+		fmt.Sprintf("bytes=%d-%d", minChunkSize, 2*minChunkSize-1):     true,
+		fmt.Sprintf("bytes=%d-%d", 2*minChunkSize, 3*minChunkSize-1):   true,
+		fmt.Sprintf("bytes=%d-%d", 3*minChunkSize, 3*minChunkSize+999): true,
+	}
+
+	requests := server.requests()
+	if len(requests) != len(expected) {
+		t.Errorf("Expected %d requests, got %v", len(expected), requests)
+	}
+	for _, r := range requests {
+		if !expected[r] {
+			t.Errorf("Unexpected request for range %q", r)
+		}
+	}
+}
+
+func TestFetchFileParallelNoRangeSupport(t *testing.T) {
+	server := &rangeServer{content: testContent(2*minChunkSize + 1), noRanges: true}
+	fetchParallel(t, server, 4)
+
+	// The probe, then a single full download
+	if requests := server.requests(); len(requests) != 2 || requests[1] != "" {
+		t.Errorf("Expected a single connection download, got %v", requests)
+	}
+}
+
+func TestFetchFileParallelSmallFile(t *testing.T) {
+	server := &rangeServer{content: testContent(1000)}
+	fetchParallel(t, server, 4)
+
+	if requests := server.requests(); len(requests) != 2 || requests[1] != "" {
+		t.Errorf("Expected a single connection download, got %v", requests)
+	}
+}
+
+func TestFetchFileParallelDisconnect(t *testing.T) {
+	var once sync.Once
+	server := &rangeServer{content: testContent(2*minChunkSize + 1000)}
+	server.disconnect = func(start int64, end int64) bool {
+		disconnect := false
+		if start == minChunkSize {
+			once.Do(func() { disconnect = true })
+		}
+		return disconnect
+	}
+
+	fetchParallel(t, server, 2)
+
+	// The second chunk resumes from the middle instead of starting over
+	resumed := fmt.Sprintf("bytes=%d-%d", minChunkSize+minChunkSize/2, 2*minChunkSize-1)
+	found := false
+	for _, r := range server.requests() {
+		found = found || r == resumed
+	}
+	if !found {
+		t.Errorf("Expected a request for %q, got %v", resumed, server.requests())
+	}
+}
@@ -0,0 +1,179 @@
+package unitycloudbuild
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultBaseURL = "https://build-api.cloud.unity3d.com/api/v1"
+
+// Client wraps a CloudBuildContext together with the HTTP client and API base
+// URL used for every request, so connections are reused across calls.
+type Client struct {
+	Context    *CloudBuildContext
+	HTTPClient *http.Client
+	BaseURL    string
+	Retry      RetryPolicy
+
+	rateLimitMu    sync.Mutex
+	rateLimit      RateLimit
+	rateLimitKnown bool
+}
+
+// RateLimit is the API rate limit state reported by the last response.
+type RateLimit struct {
+	// Remaining is the number of requests left until Reset, or -1 if unknown.
+	Remaining int
+	Reset     time.Time
+}
+
+func parseRateLimit(header http.Header) RateLimit {
+	rateLimit := RateLimit{Remaining: -1}
+
+	if v, err := strconv.Atoi(header.Get("X-RateLimit-Remaining")); err == nil {
+		rateLimit.Remaining = v
+	}
+
+	if v, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		rateLimit.Reset = time.Unix(v, 0)
+	}
+
+	return rateLimit
+}
+
+// RateLimit returns the rate limit reported by the most recent API response.
+func (c *Client) RateLimit() RateLimit {
+	c.rateLimitMu.Lock()
+	defer c.rateLimitMu.Unlock()
+
+	if !c.rateLimitKnown {
+		return RateLimit{Remaining: -1}
+	}
+	return c.rateLimit
+}
+
+func NewClient(context *CloudBuildContext) *Client {
+	return &Client{
+		Context:    context,
+		HTTPClient: &http.Client{},
+		BaseURL:    DefaultBaseURL,
+		Retry:      DefaultRetryPolicy,
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+func (c *Client) doRequest(req *http.Request, result interface{}) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := c.doRequestOnce(req, result)
+		if err == nil || !c.Retry.shouldRetry(req.Method, attempt, err) {
+			return resp, err
+		}
+
+		delay := c.Retry.delay(attempt, err)
+		if c.Context.Verbose {
+			log.Printf("Retrying %s %s in %v (attempt %d of %d): %v", req.Method, req.URL.Path, delay, attempt+1, c.Retry.MaxAttempts, err)
+		}
+
+		select {
+		case <-req.Context().Done():
+			return resp, req.Context().Err()
+		case <-time.After(delay):
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return resp, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+func (c *Client) doRequestOnce(req *http.Request, result interface{}) (*http.Response, error) {
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Context.Verbose {
+		log.Print("X-RateLimit-Remaining:", resp.Header.Get("X-RateLimit-Remaining"))
+	}
+
+	if rateLimit := parseRateLimit(resp.Header); rateLimit.Remaining >= 0 {
+		c.rateLimitMu.Lock()
+		c.rateLimit = rateLimit
+		c.rateLimitKnown = true
+		c.rateLimitMu.Unlock()
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case 200, 202:
+		if raw, ok := result.(*[]byte); ok {
+			// Non-JSON responses such as build logs
+			*raw = body
+		} else if result != nil {
+			if err = json.Unmarshal(body, &result); err != nil {
+				return resp, &DecodeError{Body: body, Err: err}
+			}
+		}
+	case 204:
+		// do nothing
+	default:
+		return resp, newAPIError(req, resp, body)
+	}
+
+	return resp, nil
+}
+
+func (c *Client) buildRequest(ctx context.Context, method string, path string, body interface{}) (*http.Request, error) {
+	var postData io.Reader
+	if body != nil {
+		d, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		postData = bytes.NewBuffer(d)
+	}
+
+	baseURL := c.BaseURL
+	if len(baseURL) == 0 {
+		baseURL = DefaultBaseURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/orgs/%s/projects/%s/%s", strings.TrimRight(baseURL, "/"), c.Context.OrgId, c.Context.ProjectId, path), postData)
+	if err != nil {
+		return nil, err
+	}
+
+	req.SetBasicAuth("", c.Context.ApiKey)
+
+	if postData != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return req, nil
+}
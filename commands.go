@@ -1,24 +1,12 @@
 package unitycloudbuild
 
 import (
-	"archive/zip"
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"log"
-	"mime"
 	"net/http"
-	"net/url"
-	"os"
-	"path"
-	"path/filepath"
-	"sort"
 	"strings"
 	"time"
-
-	"gopkg.in/src-d/go-git.v4"
 )
 
 type OutputFormat int
@@ -27,12 +15,34 @@ const (
 	OutputFormat_None OutputFormat = iota
 	OutputFormat_JSON
 	OutputFormat_Human
+	OutputFormat_Table
+	OutputFormat_CSV
+	OutputFormat_YAML
 )
 
+var outputFormatNames = map[string]OutputFormat{
+	"none":  OutputFormat_None,
+	"json":  OutputFormat_JSON,
+	"human": OutputFormat_Human,
+	"table": OutputFormat_Table,
+	"csv":   OutputFormat_CSV,
+	"yaml":  OutputFormat_YAML,
+}
+
+func ParseOutputFormat(name string) (OutputFormat, error) {
+	if format, ok := outputFormatNames[strings.ToLower(name)]; ok {
+		return format, nil
+	}
+	return OutputFormat_None, fmt.Errorf("Unknown output format: %s", name)
+}
+
 type CloudBuildContext struct {
-	OrgId        string       `json:"orgid"`
-	ProjectId    string       `json:"projectid"`
-	ApiKey       string       `json:"apikey"`
+	OrgId     string `json:"orgid"`
+	ProjectId string `json:"projectid"`
+	ApiKey    string `json:"apikey"`
+
+	// OutputFormat only controls progress messages from long running
+	// operations (waiting, downloading). Data is rendered with a Renderer.
 	OutputFormat OutputFormat `json:"outputformat"`
 	Verbose      bool
 }
@@ -59,153 +69,36 @@ var platformShorthand = map[string]string{
 	"":      "",
 }
 
-var RateLimitedError = fmt.Errorf("API rate limit reached")
-var ResourceNotFoundError = fmt.Errorf("Resource not found")
-
 func init() {
 	for _, p := range validPlatforms {
 		platformShorthand[p] = p
 	}
 }
 
-func FatalIfError(err error) {
-	if err != nil {
-		log.Fatal(err)
-	}
-}
-
-func Git_BuildsMatchHead(context *CloudBuildContext, repoPath string, buildTargetId string, buildNumber int64, all bool) (bool, error) {
-	quietContext := *context
-	if !context.Verbose {
-		quietContext.OutputFormat = OutputFormat_None
-	}
-
-	commit, err := Git_Head(&quietContext, repoPath)
-	if err != nil {
-		return false, err
-	}
-
-	if context.OutputFormat == OutputFormat_Human {
-		fmt.Printf("HEAD: %s\n", commit.Revision)
-	}
-
-	var builds []*Build
-	var missingBuilds []string
-
-	if all {
-		latestBuilds, err := Builds_Latest(&quietContext, true, true)
-		if err != nil {
-			return false, err
-		}
-		for targetName, build := range latestBuilds {
-			if build == nil {
-				missingBuilds = append(missingBuilds, targetName)
-				continue
-			}
-			builds = append(builds, build)
-		}
-	} else if buildNumber > 0 {
-		build, err := Builds_Status(&quietContext, buildTargetId, buildNumber)
-		if err != nil {
-			return false, err
-		}
-		builds = append(builds, build)
-	} else {
-		latestBuilds, err := Builds_Latest(&quietContext, true, true)
-		if err != nil {
-			return false, err
-		} else if build, ok := latestBuilds[buildTargetId]; ok {
-			if build == nil {
-				missingBuilds = append(missingBuilds, buildTargetId)
-			} else {
-				builds = append(builds, build)
-			}
-		}
-	}
-
-	allMatch := true
-
-	for _, targetName := range missingBuilds {
-		if context.OutputFormat == OutputFormat_Human {
-			fmt.Printf("Target %s does not have a successful build.\n", targetName)
-		}
-
-		allMatch = false
-	}
-
-	for _, build := range builds {
-		if build.Status != "success" {
-			if context.OutputFormat == OutputFormat_Human {
-				fmt.Printf("Build %s #%d is not a successful build\n", build.TargetId, build.Number)
-			}
-			allMatch = false
-			continue
-		}
-
-		if build.LastBuiltRevision != commit.Revision {
-			if context.OutputFormat == OutputFormat_Human {
-				fmt.Printf("Build %s #%d is revision %s, head is %s\n", build.TargetId, build.Number, build.LastBuiltRevision[:8], commit.Revision[:8])
-			}
-
-			allMatch = false
-			continue
-		}
-
-		if context.OutputFormat == OutputFormat_Human {
-			fmt.Printf("Build %s #%d matches HEAD.\n", build.TargetId, build.Number)
-		}
-	}
-
-	return allMatch, nil
-}
-
-func Git_Head(context *CloudBuildContext, repoPath string) (*GitCommit, error) {
-	if repoPath == "" {
-		repoPath = "."
-	}
-
-	repo, err := git.PlainOpenWithOptions(repoPath, &git.PlainOpenOptions{
-		DetectDotGit: true,
-	})
-
-	if err != nil {
-		return nil, err
-	}
+// WaitOptions control how Builds_WaitForComplete gives up on builds.
+type WaitOptions struct {
+	// AbortOnFail returns as soon as one build fails or is canceled, instead
+	// of waiting for the others.
+	AbortOnFail bool
 
-	head, err := repo.Head()
-	FatalIfError(err)
+	// Timeout limits the total time spent waiting.
+	Timeout time.Duration
 
-	commit, err := repo.CommitObject(head.Hash())
-	FatalIfError(err)
+	// QueueTimeout and StallTimeout fail the wait as soon as one build is
+	// stuck, see WatchOptions.
+	QueueTimeout time.Duration
+	StallTimeout time.Duration
 
-	info := &GitCommit{
-		Revision: commit.Hash.String(),
-		Message:  commit.Message,
-	}
-
-	switch context.OutputFormat {
-	case OutputFormat_None:
-		// do nothing
-	case OutputFormat_Human:
-		fmt.Printf("Revision: %s\n", info.Revision)
-		fmt.Printf("Message:  %s\n", info.Message)
-	case OutputFormat_JSON:
-		dumpJson(info)
-	}
-
-	return info, nil
+	// CancelOnTimeout cancels the builds named in the WaitTimeoutError: the
+	// stuck build, or all unfinished builds if Timeout was exceeded.
+	CancelOnTimeout bool
 }
 
-func Builds_WaitForComplete(context *CloudBuildContext, buildTargetId string, buildNumber int64, all bool, abortOnFail bool) error {
-	quietContext := *context
-	if !context.Verbose {
-		quietContext.OutputFormat = OutputFormat_None
-	}
-
+func (c *Client) Builds_WaitForComplete(ctx context.Context, buildTargetId string, buildNumber int64, all bool, options WaitOptions) error {
 	var builds []*Build
 
 	if all {
-		latestBuilds, err := Builds_Latest(&quietContext, false, true)
+		latestBuilds, err := c.Builds_Latest(ctx, false, true)
 		if err != nil {
 			return err
 		}
@@ -215,13 +108,13 @@ func Builds_WaitForComplete(context *CloudBuildContext, buildTargetId string, bu
 			}
 		}
 	} else if buildNumber > 0 {
-		build, err := Builds_Status(&quietContext, buildTargetId, buildNumber)
+		build, err := c.Builds_Status(ctx, buildTargetId, buildNumber)
 		if err != nil {
 			return err
 		}
 		builds = append(builds, build)
 	} else {
-		latestBuilds, err := Builds_Latest(&quietContext, false, true)
+		latestBuilds, err := c.Builds_Latest(ctx, false, true)
 		if err != nil {
 			return err
 		} else if build, ok := latestBuilds[buildTargetId]; ok && build != nil {
@@ -233,91 +126,137 @@ func Builds_WaitForComplete(context *CloudBuildContext, buildTargetId string, bu
 		return fmt.Errorf("No builds found")
 	}
 
-	finishedBuilds := make(map[string]bool)
-	lastBuildStatus := make(map[string]string)
 	for _, build := range builds {
 		if !IsBuildActive(build) {
 			return fmt.Errorf("Build #%d for target %s is not active", build.Number, build.TargetId)
 		}
+	}
 
-		finishedBuilds[build.UniqueId()] = false
-		lastBuildStatus[build.UniqueId()] = build.Status
+	_, err := c.Builds_Wait(ctx, builds, options)
+	return err
+}
 
-		if context.OutputFormat == OutputFormat_Human {
+// Builds_Wait waits for the given builds to finish and returns their final
+// state. On error, the last known state of each build is returned.
+func (c *Client) Builds_Wait(ctx context.Context, builds []*Build, options WaitOptions) ([]*Build, error) {
+	if c.Context.OutputFormat == OutputFormat_Human {
+		for _, build := range builds {
 			fmt.Printf("Watching: %s #%d\n", build.TargetId, build.Number)
 		}
 	}
 
-	pollRate := time.Second * 5
-	finishedBuildsCount := 0
+	var failedBuild *Build
 
-Poll:
-	for {
-		select {
-		case <-time.After(pollRate):
-			if context.Verbose {
-				log.Print("Polling...")
-			}
+	// The latest state of each build
+	latest := make(map[string]*Build, len(builds))
+	for _, build := range builds {
+		latest[build.UniqueId()] = build
+	}
 
-			for i, build := range builds {
-				if finishedBuilds[build.UniqueId()] {
-					continue
-				}
+	current := func() []*Build {
+		result := make([]*Build, len(builds))
+		for i, build := range builds {
+			result[i] = latest[build.UniqueId()]
+		}
+		return result
+	}
 
-				updatedBuild, err := Builds_Status(&quietContext, build.TargetId, int64(build.Number))
-				if err == RateLimitedError {
-					log.Print("Rate limit hit, backing off")
-					break
-				} else if err != nil {
-					return err
-				}
+	watchCtx := ctx
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		watchCtx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
 
-				builds[i] = updatedBuild
-				build = updatedBuild
+	watchOptions := WatchOptions{
+		Adaptive:     true,
+		QueueTimeout: options.QueueTimeout,
+		StallTimeout: options.StallTimeout,
+	}
 
-				if lastStatus := lastBuildStatus[build.UniqueId()]; lastStatus != build.Status {
-					if context.OutputFormat == OutputFormat_Human {
-						fmt.Printf("Build: %s #%d status changed from %s to %s\n", build.TargetId, build.Number, lastStatus, build.Status)
-					}
+	err := c.WatchFunc(watchCtx, builds, watchOptions, func(event BuildEvent) error {
+		build := event.EventBuild()
+		latest[build.UniqueId()] = build
 
-					lastBuildStatus[build.UniqueId()] = build.Status
-				}
+		switch event := event.(type) {
+		case StatusChanged:
+			if c.Context.OutputFormat == OutputFormat_Human {
+				fmt.Printf("Build: %s #%d status changed from %s to %s\n", build.TargetId, build.Number, event.From, event.To)
+			}
+		case BuildStalled:
+			timeoutErr := &WaitTimeoutError{Reason: "stall timeout", Timeout: options.StallTimeout, Builds: []*Build{build}}
+			if event.Queued {
+				timeoutErr.Reason, timeoutErr.Timeout = "queue timeout", options.QueueTimeout
+			}
+			return timeoutErr
+		case BuildFinished:
+			if c.Context.OutputFormat == OutputFormat_Human {
+				fmt.Printf("Build: %s #%d finished.\n", build.TargetId, build.Number)
+			}
+		case BuildFailed:
+			if failedBuild == nil {
+				failedBuild = build
+			}
 
-				if !IsBuildActive(build) {
-					finishedBuilds[build.UniqueId()] = true
-					finishedBuildsCount++
-
-					if context.OutputFormat == OutputFormat_Human {
-						if build.Status != "success" {
-							fmt.Printf("Build: %s #%d failed with status: %s\n", build.TargetId, build.Number, build.Status)
-						} else {
-							fmt.Printf("Build: %s #%d finished.\n", build.TargetId, build.Number)
-						}
-					}
-
-					if abortOnFail && build.Status != "success" {
-						return fmt.Errorf("Aborting early, build: %s #%d failed with status: %s", build.TargetId, build.Number, build.Status)
-					}
+			if c.Context.OutputFormat == OutputFormat_Human {
+				fmt.Printf("Build: %s #%d failed with status: %s\n", build.TargetId, build.Number, build.Status)
+				if build.Status == "failure" {
+					c.printFailureSummary(ctx, build)
 				}
 			}
 
-			if finishedBuildsCount == len(builds) {
-				break Poll
+			if options.AbortOnFail {
+				return fmt.Errorf("Aborting early, build: %s #%d failed with status: %s", build.TargetId, build.Number, build.Status)
 			}
 		}
-	}
 
-	for _, build := range builds {
-		if build.Status != "success" {
-			return fmt.Errorf("Build: %s #%d failed", build.TargetId, build.Number)
+		return nil
+	})
+
+	if errors.Is(err, context.DeadlineExceeded) && options.Timeout > 0 && ctx.Err() == nil {
+		timeoutErr := &WaitTimeoutError{Reason: "timeout", Timeout: options.Timeout}
+		for _, build := range current() {
+			if IsBuildActive(build) {
+				timeoutErr.Builds = append(timeoutErr.Builds, build)
+			}
 		}
+		err = timeoutErr
+	}
+
+	var timeoutErr *WaitTimeoutError
+	if errors.As(err, &timeoutErr) && options.CancelOnTimeout {
+		timeoutErr.CancelErrors = c.cancelBuilds(ctx, timeoutErr.Builds)
+	}
+
+	if err != nil {
+		return current(), err
+	}
+
+	if failedBuild != nil {
+		return current(), fmt.Errorf("Build: %s #%d failed", failedBuild.TargetId, failedBuild.Number)
 	}
 
-	if context.OutputFormat == OutputFormat_Human {
+	if c.Context.OutputFormat == OutputFormat_Human {
 		fmt.Printf("Build(s) complete.\n")
 	}
 
-	return nil
+	return current(), nil
+}
+
+// cancelBuilds cancels builds after a wait timed out. All builds are tried,
+// and the failures are returned to be reported with the timeout.
+func (c *Client) cancelBuilds(ctx context.Context, builds []*Build) []error {
+	var errs []error
+	for _, build := range builds {
+		if c.Context.OutputFormat == OutputFormat_Human {
+			fmt.Printf("Canceling: %s #%d\n", build.TargetId, build.Number)
+		}
+
+		if err := c.Builds_Cancel(ctx, build.TargetId, int64(build.Number)); err != nil {
+			errs = append(errs, fmt.Errorf("Could not cancel %s #%d: %w", build.TargetId, build.Number, err))
+		}
+	}
+	return errs
 }
 
 func IsBuildActive(build *Build) bool {
@@ -329,279 +268,149 @@ func IsBuildActive(build *Build) bool {
 	}
 }
 
-func Builds_Download(context *CloudBuildContext, buildTargetId string, buildNumber int64, latest bool, outputDir string, unzip bool) error {
-	quietContext := *context
-	quietContext.OutputFormat = OutputFormat_None
+// StartOptions are sent with a request to start builds. Fields that are not
+// set are left to the build target's settings. The machine type cannot be
+// chosen per build, it is a setting of the build target.
+type StartOptions struct {
+	// Clean forces a clean build, without the library cache.
+	Clean bool `json:"clean,omitempty"`
 
-	// Find the build information
-	var build *Build
-	var err error
+	// Commit is the SCM revision to build instead of the head of the
+	// target's branch.
+	Commit string `json:"commit,omitempty"`
 
-	if !latest {
-		build, err = Builds_Status(&quietContext, buildTargetId, buildNumber)
-		if err != nil {
-			log.Fatal(err)
-		}
-	} else {
-		targetBuilds, err := Builds_List(&quietContext, buildTargetId, "success", "", 1)
-		if err != nil {
-			log.Fatal(err)
-		} else if len(targetBuilds) == 0 {
-			return fmt.Errorf("No successful build for target %s", buildTargetId)
-		}
+	// Headless starts a headless build, for targets that support it.
+	Headless bool `json:"headless,omitempty"`
 
-		build = &targetBuilds[0]
+	// Label is shown with the build on the dashboard.
+	Label string `json:"label,omitempty"`
 
-		if context.OutputFormat == OutputFormat_Human {
-			fmt.Printf("Latest build is #%d.\n", build.Number)
-		}
-	}
-
-	if context.Verbose {
-		log.Printf("Found build #%d for target %s, status: %s", build.Number, build.TargetId, build.Status)
-	}
-
-	if build.Status != "success" {
-		return fmt.Errorf("Cannot download build, status is '%s'", build.Status)
-	} else if build.Links.DownloadPrimary == nil {
-		return fmt.Errorf("Missing download link for build")
-	} else if unzip && strings.ToLower(build.Links.DownloadPrimary.Meta.Type) != "zip" {
-		return fmt.Errorf("Cannot unzip build, filetype is %s", strings.ToLower(build.Links.DownloadPrimary.Meta.Type))
-	}
+	// Platform overrides the platform to build. It can be any platform
+	// accepted by Builds_List, including shorthands like "win64".
+	Platform string `json:"platform,omitempty"`
+}
 
-	// Check output dir status
-	if len(outputDir) == 0 {
-		outputDir = "."
+// startRequest returns the request to start builds for buildTargetId, which
+// may be "_all".
+func (c *Client) startRequest(ctx context.Context, buildTargetId string, options StartOptions) (*http.Request, error) {
+	if len(options.Platform) != 0 {
+		platform, ok := platformShorthand[options.Platform]
+		if !ok {
+			return nil, &InvalidPlatformError{Platform: options.Platform}
+		}
+		options.Platform = platform
 	}
 
-	outputDirInfo, err := os.Stat(outputDir)
-	if os.IsNotExist(err) || !outputDirInfo.IsDir() {
-		return fmt.Errorf("Error: %s is not a directory or does not exist", outputDir)
-	} else if err != nil {
-		return fmt.Errorf("Error stat'ing directory: %v", err)
-	}
+	return c.buildRequest(ctx, "POST", fmt.Sprintf("buildtargets/%s/builds", buildTargetId), options)
+}
 
-	// Determine output location
-	_url, err := url.Parse(build.Links.DownloadPrimary.Href)
+func (c *Client) Builds_Start(ctx context.Context, buildTargetId string, options StartOptions) (*BuildAttempt, error) {
+	req, err := c.startRequest(ctx, buildTargetId, options)
 	if err != nil {
-		return err
-	}
-
-	filename := path.Base(_url.Path)
-	if _, params, err := mime.ParseMediaType(_url.Query().Get("response-content-disposition")); err == nil {
-		filename = params["filename"]
-	}
-
-	var file *os.File
-	if !unzip {
-		if context.Verbose {
-			log.Printf("Using filename: %s\n", filename)
-		}
-
-		filename = filepath.Join(outputDir, filename)
-		file, err = os.Create(filename)
-		if err != nil {
-			return err
-		}
-	} else {
-		file, err = ioutil.TempFile("", filename)
-		if err != nil {
-			return err
-		}
+		return nil, err
 	}
 
-	defer file.Close()
-	if context.OutputFormat == OutputFormat_Human {
-		fmt.Printf("Downloading to: %s\n", file.Name())
-	}
+	var entries []BuildAttempt
+	_, err = c.doRequest(req, &entries)
 
-	// Download build
-	err = grabHttpFile(context, _url, file)
 	if err != nil {
-		// Deferring to have it happen after file.Close()
-		defer func() {
-			os.Remove(file.Name())
-		}()
-		return err
+		return nil, err
+	} else if entries == nil || len(entries) == 0 {
+		return nil, fmt.Errorf("No builds started...")
+	} else if len(entries[0].Error) > 0 {
+		return nil, errors.New(entries[0].Error)
 	}
 
-	if context.OutputFormat == OutputFormat_Human {
-		fmt.Printf("Download complete.\n")
-	}
+	return &entries[0], nil
+}
 
-	if !unzip {
-		return nil
+func (c *Client) Builds_StartAll(ctx context.Context, options StartOptions) ([]BuildAttempt, error) {
+	req, err := c.startRequest(ctx, "_all", options)
+	if err != nil {
+		return nil, err
 	}
 
-	// Handle unzipping, need to abstract out at some point...
-	defer func() {
-		os.Remove(file.Name())
-	}()
-
-	if err := file.Sync(); err != nil {
-		return err
-	}
+	var entries []BuildAttempt
 
-	zipReader, err := zip.OpenReader(file.Name())
+	_, err = c.doRequest(req, &entries)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if context.OutputFormat == OutputFormat_Human {
-		fmt.Printf("Unzipping content to: %s\n", outputDir)
+	if entries == nil || len(entries) == 0 {
+		return nil, fmt.Errorf("No builds started...")
 	}
 
-	for _, zippedFile := range zipReader.File {
-		filePath := filepath.Join(outputDir, filepath.FromSlash(zippedFile.Name))
+	return entries, nil
+}
 
-		if zippedFile.FileInfo().IsDir() {
-			if err := os.MkdirAll(filePath, zippedFile.Mode()); err != nil {
-				return err
-			}
-			continue
-		} else {
-			dir, _ := filepath.Split(filePath)
-			if err := os.MkdirAll(dir, outputDirInfo.Mode()); err != nil {
-				return err
-			}
-		}
+// Builds_Run starts a build of a target, or of all enabled targets if all is
+// set, and waits for exactly the builds that were started, unlike
+// Builds_WaitForComplete which could pick up a build started by someone else.
+// Targets that could not be started make Builds_Run fail once the other
+// builds have finished, or right away if options.AbortOnFail is set.
+func (c *Client) Builds_Run(ctx context.Context, buildTargetId string, all bool, start StartOptions, options WaitOptions) ([]*Build, error) {
+	var attempts []BuildAttempt
 
-		if context.OutputFormat == OutputFormat_Human {
-			fmt.Println("Writing:", filePath)
+	if all {
+		var err error
+		if attempts, err = c.Builds_StartAll(ctx, start); err != nil {
+			return nil, err
 		}
-
-		fileReader, err := zippedFile.Open()
+	} else {
+		attempt, err := c.Builds_Start(ctx, buildTargetId, start)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		attempts = append(attempts, *attempt)
+	}
 
-		if err = func() error {
-			defer fileReader.Close()
-
-			targetFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, zippedFile.Mode())
-			if err != nil {
-				return err
-			}
+	var builds []*Build
+	var notStarted []string
 
-			defer targetFile.Close()
+	for i := range attempts {
+		attempt := &attempts[i]
 
-			if _, err := io.Copy(targetFile, fileReader); err != nil {
-				return err
+		if len(attempt.Error) > 0 {
+			if c.Context.OutputFormat == OutputFormat_Human {
+				fmt.Printf("Failed to start %s: %s\n", attempt.TargetId, attempt.Error)
 			}
-			return nil
-		}(); err != nil {
-			return err
+			notStarted = append(notStarted, attempt.TargetId)
+			continue
 		}
-	}
-
-	return nil
-}
-
-func grabHttpFile(context *CloudBuildContext, _url *url.URL, dst io.Writer) error {
-	if context.Verbose {
-		log.Println(_url)
-	}
-
-	resp, err := http.Get(_url.String())
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
 
-	if context.Verbose {
-		for name, val := range resp.Header {
-			log.Printf("Response header: %s=%s", name, val)
+		if c.Context.OutputFormat == OutputFormat_Human {
+			fmt.Printf("Started: %s #%d\n", attempt.TargetId, attempt.Number)
 		}
+		builds = append(builds, &attempt.Build)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Could not download, got status code: %d", resp.StatusCode)
-	}
-
-	if _, err = io.Copy(dst, resp.Body); err != nil {
-		return err
+	if len(builds) == 0 {
+		return nil, fmt.Errorf("No builds started...")
+	} else if len(notStarted) > 0 && options.AbortOnFail {
+		return builds, fmt.Errorf("Aborting early, could not start: %s", strings.Join(notStarted, ", "))
 	}
 
-	return nil
-}
-
-func Builds_Start(context *CloudBuildContext, buildTargetId string, clean bool) (*BuildAttempt, error) {
-	client := &http.Client{}
-	req := buildRequest(
-		context, "POST", fmt.Sprintf("buildtargets/%s/builds", buildTargetId),
-		struct {
-			clean bool
-		}{clean: clean})
-
-	var entries []BuildAttempt
-	_, err := doRequest(context, client, req, &entries)
-
+	builds, err := c.Builds_Wait(ctx, builds, options)
 	if err != nil {
-		return nil, err
-	} else if entries == nil || len(entries) == 0 {
-		return nil, fmt.Errorf("No builds started...")
-	} else if len(entries[0].Error) > 0 {
-		return nil, fmt.Errorf(entries[0].Error)
+		return builds, err
 	}
 
-	switch context.OutputFormat {
-	case OutputFormat_None:
-		// do nothing
-	case OutputFormat_Human:
-		outputBuild(entries[0].Build)
-		fmt.Println()
-	case OutputFormat_JSON:
-		dumpJson(entries[0])
+	if len(notStarted) > 0 {
+		return builds, fmt.Errorf("Could not start: %s", strings.Join(notStarted, ", "))
 	}
 
-	return &entries[0], nil
+	return builds, nil
 }
 
-func Builds_StartAll(context *CloudBuildContext, clean bool) ([]BuildAttempt, error) {
-	client := &http.Client{}
-	req := buildRequest(
-		context, "POST", "buildtargets/_all/builds",
-		struct {
-			clean bool
-		}{clean: clean})
-
-	var entries []BuildAttempt
-
-	_, err := doRequest(context, client, req, &entries)
+func (c *Client) Builds_Cancel(ctx context.Context, buildTargetId string, buildNumber int64) error {
+	req, err := c.buildRequest(ctx, "DELETE", fmt.Sprintf("buildtargets/%s/builds/%d", buildTargetId, buildNumber), nil)
 	if err != nil {
-		return nil, err
-	}
-
-	if entries == nil || len(entries) == 0 {
-		return nil, fmt.Errorf("No builds started...")
-	}
-
-	switch context.OutputFormat {
-	case OutputFormat_None:
-		// do nothing
-	case OutputFormat_Human:
-		for _, buildAttempt := range entries {
-			if len(buildAttempt.Error) > 0 {
-				fmt.Printf("Target: %s\n", buildAttempt.Build.TargetId)
-				fmt.Printf("  Error: %s\n", buildAttempt.Error)
-			} else {
-				outputBuild(buildAttempt.Build)
-			}
-			fmt.Println()
-		}
-	case OutputFormat_JSON:
-		dumpJson(entries[0])
+		return err
 	}
 
-	return entries, nil
-}
-
-func Builds_Cancel(context *CloudBuildContext, buildTargetId string, buildNumber int64) error {
-	client := &http.Client{}
-	req := buildRequest(context, "DELETE", fmt.Sprintf("buildtargets/%s/builds/%d", buildTargetId, buildNumber), nil)
-
-	_, err := doRequest(context, client, req, nil)
-	if err == ResourceNotFoundError {
+	_, err = c.doRequest(req, nil)
+	if errors.Is(err, ResourceNotFoundError) {
 		return fmt.Errorf("Cannot find %s build #%d", buildTargetId, buildNumber)
 	} else if err != nil {
 		return err
@@ -610,38 +419,38 @@ func Builds_Cancel(context *CloudBuildContext, buildTargetId string, buildNumber
 	return nil
 }
 
-func Builds_CancelAll(context *CloudBuildContext, buildTargetId string) error {
+func (c *Client) Builds_CancelAll(ctx context.Context, buildTargetId string) error {
 	/* Right now this correct way of canceling all builds is bugged on the Cloud Build
 	   side and returning an HTTP 500 error.
 
 	   So we need to do things the hard way and get all targets, and then for each target
 	   call the cancel builds endpoint.
 
-	client := &http.Client{}
-	req := buildRequest(context, "DELETE", "buildtargets/_all/builds")
+	req := c.buildRequest(ctx, "DELETE", "buildtargets/_all/builds")
 
-	resp := doRequest(context, client, req, nil)
+	resp := c.doRequest(req, nil)
 	if resp.StatusCode == 404 {
 		log.Fatalf("Cannot find resource")
 	}
 	*/
 
-	targetsContext := *context
-	targetsContext.OutputFormat = OutputFormat_None
-	targets, err := Targets_List(&targetsContext)
+	targets, err := c.Targets_List(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	client := &http.Client{}
 	for _, target := range targets {
 		// If a specific target has been specified, ignore other targets.
 		if len(buildTargetId) > 0 && buildTargetId != target.Id {
 			continue
 		}
 
-		req := buildRequest(context, "DELETE", fmt.Sprintf("buildtargets/%s/builds", target.Id), nil)
-		_, err := doRequest(context, client, req, nil)
+		req, err := c.buildRequest(ctx, "DELETE", fmt.Sprintf("buildtargets/%s/builds", target.Id), nil)
+		if err != nil {
+			return err
+		}
+
+		_, err = c.doRequest(req, nil)
 		if err != nil {
 			return err
 		}
@@ -650,32 +459,26 @@ func Builds_CancelAll(context *CloudBuildContext, buildTargetId string) error {
 	return nil
 }
 
-func Builds_Status(context *CloudBuildContext, buildTargetId string, buildNumber int64) (*Build, error) {
-	client := &http.Client{}
-	req := buildRequest(context, "GET", fmt.Sprintf("buildtargets/%s/builds/%d", buildTargetId, buildNumber), nil)
-
-	var build Build
-	_, err := doRequest(context, client, req, &build)
+func (c *Client) Builds_Status(ctx context.Context, buildTargetId string, buildNumber int64) (*Build, error) {
+	req, err := c.buildRequest(ctx, "GET", fmt.Sprintf("buildtargets/%s/builds/%d", buildTargetId, buildNumber), nil)
 	if err != nil {
 		return nil, err
 	}
 
-	switch context.OutputFormat {
-	case OutputFormat_None:
-		// do nothing
-	case OutputFormat_Human:
-		outputBuild(build)
-		fmt.Println()
-	case OutputFormat_JSON:
-		dumpJson(build)
+	var build Build
+	_, err = c.doRequest(req, &build)
+	if err != nil {
+		return nil, err
 	}
 
 	return &build, nil
 }
 
-func Builds_List(context *CloudBuildContext, buildTargetId string, filterStatus string, filterPlatform string, limit int64) ([]Build, error) {
-	client := &http.Client{}
-	req := buildRequest(context, "GET", fmt.Sprintf("buildtargets/%s/builds", buildTargetId), nil)
+func (c *Client) Builds_List(ctx context.Context, buildTargetId string, filterStatus string, filterPlatform string, limit int64) ([]Build, error) {
+	req, err := c.buildRequest(ctx, "GET", fmt.Sprintf("buildtargets/%s/builds", buildTargetId), nil)
+	if err != nil {
+		return nil, err
+	}
 
 	q := req.URL.Query()
 	if len(filterStatus) != 0 {
@@ -686,7 +489,7 @@ func Builds_List(context *CloudBuildContext, buildTargetId string, filterStatus
 		if val, ok := platformShorthand[filterPlatform]; ok {
 			q.Add("platform", val)
 		} else {
-			log.Fatalf("No such platform: %s", filterPlatform)
+			return nil, &InvalidPlatformError{Platform: filterPlatform}
 		}
 	}
 
@@ -694,7 +497,7 @@ func Builds_List(context *CloudBuildContext, buildTargetId string, filterStatus
 
 	var entries []Build
 
-	_, err := doRequest(context, client, req, &entries)
+	_, err = c.doRequest(req, &entries)
 	if err != nil {
 		return nil, err
 	}
@@ -703,27 +506,17 @@ func Builds_List(context *CloudBuildContext, buildTargetId string, filterStatus
 		entries = entries[0:min(len(entries), int(limit))]
 	}
 
-	switch context.OutputFormat {
-	case OutputFormat_None:
-		// do nothing
-	case OutputFormat_Human:
-		for _, build := range entries {
-			outputBuild(build)
-			fmt.Println()
-		}
-	case OutputFormat_JSON:
-		dumpJson(entries)
-	}
-
 	return entries, nil
 }
 
-func Builds_Latest(context *CloudBuildContext, onlySuccess bool, onlyEnabled bool) (map[string]*Build, error) {
-	client := &http.Client{}
+func (c *Client) Builds_Latest(ctx context.Context, onlySuccess bool, onlyEnabled bool) (map[string]*Build, error) {
 	builds := make(map[string]*Build)
 
 	// Get all targets along with builds
-	req := buildRequest(context, "GET", "buildtargets", nil)
+	req, err := c.buildRequest(ctx, "GET", "buildtargets", nil)
+	if err != nil {
+		return nil, err
+	}
 
 	q := req.URL.Query()
 	q.Add("include_last_success", "true")
@@ -731,7 +524,7 @@ func Builds_Latest(context *CloudBuildContext, onlySuccess bool, onlyEnabled boo
 
 	var targets []BuildTarget
 
-	_, err := doRequest(context, client, req, &targets)
+	_, err = c.doRequest(req, &targets)
 	if err != nil {
 		return nil, err
 	}
@@ -749,15 +542,12 @@ func Builds_Latest(context *CloudBuildContext, onlySuccess bool, onlyEnabled boo
 	}
 
 	if !onlySuccess {
-		quietContext := *context
-		quietContext.OutputFormat = OutputFormat_None
-
 		for _, target := range targets {
 			if onlyEnabled && !target.Enabled {
 				continue
 			}
 
-			targetBuilds, err := Builds_List(&quietContext, target.Id, "", "", 1)
+			targetBuilds, err := c.Builds_List(ctx, target.Id, "", "", 1)
 			if err != nil {
 				return nil, err
 			}
@@ -767,39 +557,14 @@ func Builds_Latest(context *CloudBuildContext, onlySuccess bool, onlyEnabled boo
 		}
 	}
 
-	switch context.OutputFormat {
-	case OutputFormat_None:
-		// do nothing
-	case OutputFormat_Human:
-		ids := make([]string, 0, len(builds))
-		for id := range builds {
-			ids = append(ids, id)
-		}
-
-		sort.Strings(ids)
-
-		for _, targetId := range ids {
-			build := builds[targetId]
-			if build != nil {
-				outputBuild(*build)
-			} else {
-				fmt.Printf("Target: %s\n", targetId)
-				fmt.Printf("  <No builds successful>\n")
-			}
-
-			fmt.Println()
-		}
-
-	case OutputFormat_JSON:
-		dumpJson(builds)
-	}
-
 	return builds, nil
 }
 
-func Targets_List(context *CloudBuildContext) ([]BuildTarget, error) {
-	client := &http.Client{}
-	req := buildRequest(context, "GET", "buildtargets", nil)
+func (c *Client) Targets_List(ctx context.Context) ([]BuildTarget, error) {
+	req, err := c.buildRequest(ctx, "GET", "buildtargets", nil)
+	if err != nil {
+		return nil, err
+	}
 
 	q := req.URL.Query()
 	q.Add("include", "settings")
@@ -807,132 +572,14 @@ func Targets_List(context *CloudBuildContext) ([]BuildTarget, error) {
 
 	var entries []BuildTarget
 
-	_, err := doRequest(context, client, req, &entries)
+	_, err = c.doRequest(req, &entries)
 	if err != nil {
 		return nil, err
 	}
 
-	switch context.OutputFormat {
-	case OutputFormat_None:
-		// do nothing
-	case OutputFormat_Human:
-		for _, target := range entries {
-			fmt.Printf("Target: %s\n", target.Name)
-			fmt.Printf("  ID:        %s\n", target.Id)
-			fmt.Printf("  Enabled:   %v\n", target.Enabled)
-			fmt.Printf("  AutoBuild: %v\n", target.Settings.AutoBuild)
-			fmt.Printf("  Branch:    %s\n", target.Settings.Scm.Branch)
-			fmt.Printf("  Unity:     %s\n", strings.Replace(target.Settings.UnityVersion, "_", ".", -1))
-			fmt.Println()
-		}
-
-	case OutputFormat_JSON:
-		dumpJson(entries)
-	}
-
 	return entries, nil
 }
 
-func outputBuild(build Build) {
-	fmt.Printf("Target: %s, (Build #%d)\n", build.TargetId, build.Number)
-	fmt.Printf("  Created:  %v\n", build.Created)
-	fmt.Printf("  GUID:     %s\n", build.GUID)
-	fmt.Printf("  Status:   %s\n", build.Status)
-	fmt.Printf("  Time:     %v\n", time.Second*time.Duration(build.TotalTimeSeconds))
-	if len(build.LastBuiltRevision) > 0 {
-		fmt.Printf("  Revision: %s\n", build.LastBuiltRevision)
-	}
-	if build.Links.DownloadPrimary != nil {
-		fmt.Printf("  Download: %s\n", build.Links.DownloadPrimary.Href)
-	}
-}
-
-func dumpJson(i interface{}) {
-	b, _ := json.MarshalIndent(i, "", "    ")
-	fmt.Println(string(b))
-}
-
-func doRequest(context *CloudBuildContext, client *http.Client, req *http.Request, result interface{}) (*http.Response, error) {
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	if context.Verbose {
-		log.Print("X-RateLimit-Remaining:", resp.Header.Get("X-RateLimit-Remaining"))
-	}
-
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	switch resp.StatusCode {
-	case 429:
-		return resp, RateLimitedError
-	case 200, 202:
-		if result != nil {
-			if err = json.Unmarshal(body, &result); err != nil {
-				log.Fatal(err)
-			}
-		}
-	case 204:
-		// do nothing
-	case 404:
-		return resp, ResourceNotFoundError
-	default:
-		var e errorMessage
-		json.Unmarshal(body, &e)
-		return nil, fmt.Errorf("[HTTP %d] %s", resp.StatusCode, e.Error)
-	}
-
-	/*
-		if resp.StatusCode == 429 {
-		}
-		if resp.StatusCode == 200 || resp.StatusCode == 202 {
-			if result != nil {
-				if err = json.Unmarshal(body, &result); err != nil {
-					log.Fatal(err)
-				}
-			}
-		} else if resp.StatusCode == 204 || resp.StatusCode == 404 {
-			// do nothing
-		} else {
-			var e errorMessage
-			json.Unmarshal(body, &e)
-			log.Fatalf("[HTTP %d] %s", resp.StatusCode, e.Error)
-		}
-	*/
-
-	return resp, nil
-}
-
-func buildRequest(context *CloudBuildContext, method string, path string, body interface{}) *http.Request {
-	var postData io.Reader
-	if body != nil {
-		d, err := json.Marshal(body)
-		if err != nil {
-			log.Fatal(err)
-		}
-		postData = bytes.NewBuffer(d)
-	}
-
-	req, err := http.NewRequest(method, fmt.Sprintf("https://build-api.cloud.unity3d.com/api/v1/orgs/%s/projects/%s/%s", context.OrgId, context.ProjectId, path), postData)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	req.SetBasicAuth("", context.ApiKey)
-
-	if postData != nil {
-		req.Header.Set("Content-Type", "application/json")
-	}
-
-	return req
-}
-
 func min(a, b int) int {
 	if a > b {
 		return b
@@ -0,0 +1,85 @@
+package unitycloudbuild
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildsWaitTimeout(t *testing.T) {
+	cases := []struct {
+		Name         string
+		Options      WaitOptions
+		CancelStatus int
+		Reason       string
+		Canceled     bool
+	}{
+		{"timeout", WaitOptions{Timeout: 50 * time.Millisecond}, 0, "timeout", false},
+		{"stall timeout", WaitOptions{StallTimeout: 50 * time.Millisecond}, 0, "stall timeout", false},
+		{"cancel on timeout", WaitOptions{Timeout: 50 * time.Millisecond, CancelOnTimeout: true}, 0, "timeout", true},
+		{"cancel on stall timeout", WaitOptions{StallTimeout: 50 * time.Millisecond, CancelOnTimeout: true}, 0, "stall timeout", true},
+		{"cancel fails", WaitOptions{Timeout: 50 * time.Millisecond, CancelOnTimeout: true}, http.StatusInternalServerError, "timeout", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			api, c := newFakeAPI(t)
+			api.cancelStatus = tc.CancelStatus
+
+			running := api.script("android", 1, "started")
+			running.Status = "started"
+			done := &Build{TargetId: "ios", Number: 2, Status: "success"}
+
+			builds, err := c.Builds_Wait(context.Background(), []*Build{running, done}, tc.Options)
+
+			var timeoutErr *WaitTimeoutError
+			if !errors.As(err, &timeoutErr) {
+				t.Fatalf("Expected a WaitTimeoutError, got %v", err)
+			}
+			if timeoutErr.Reason != tc.Reason {
+				t.Errorf("Expected reason %q, got %q", tc.Reason, timeoutErr.Reason)
+			}
+			if len(timeoutErr.Builds) != 1 || timeoutErr.Builds[0].UniqueId() != "android-#1" {
+				t.Errorf("Expected only android #1 to time out, got %v", timeoutErr.Builds)
+			}
+			if len(builds) != 2 || builds[0].Status != "started" || builds[1].Status != "success" {
+				t.Errorf("Expected the last known state of the builds, got %v", builds)
+			}
+
+			var deletes []string
+			for _, request := range api.requestLog() {
+				if strings.HasPrefix(request, "DELETE ") {
+					deletes = append(deletes, request)
+				}
+			}
+
+			if !tc.Canceled {
+				if len(deletes) != 0 {
+					t.Errorf("Expected no builds to be canceled, got %v", deletes)
+				}
+				return
+			}
+
+			if len(deletes) == 0 || deletes[0] != "DELETE buildtargets/android/builds/1" {
+				t.Errorf("Expected android #1 to be canceled, got %v", deletes)
+			}
+			// Failed cancels are retried, but only for the timed out build
+			for _, request := range deletes {
+				if request != deletes[0] {
+					t.Errorf("Expected only android #1 to be canceled, got %v", deletes)
+				}
+			}
+
+			if tc.CancelStatus == 0 {
+				if len(timeoutErr.CancelErrors) != 0 {
+					t.Errorf("Expected no cancel errors, got %v", timeoutErr.CancelErrors)
+				}
+			} else if len(timeoutErr.CancelErrors) != 1 || !strings.Contains(err.Error(), "Could not cancel android #1") {
+				t.Errorf("Expected the failed cancel in the error, got %v", err)
+			}
+		})
+	}
+}
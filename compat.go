@@ -0,0 +1,103 @@
+package unitycloudbuild
+
+import (
+	"context"
+	"log"
+	"os"
+)
+
+// The functions below are the API from before Client was introduced. Each one
+// makes its requests with a new Client, so connections are not reused and
+// requests cannot be canceled. As before, results are also printed to stdout
+// in the context's OutputFormat.
+
+func printResult(cbContext *CloudBuildContext, v interface{}, err error) {
+	if err == nil {
+		NewRenderer(cbContext.OutputFormat, nil).Render(os.Stdout, v)
+	}
+}
+
+// FatalIfError logs err and exits if it is not nil.
+//
+// Deprecated: Handle the error instead, the library no longer exits on
+// failure.
+func FatalIfError(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Deprecated: Use Client.Git_BuildsMatchHead.
+func Git_BuildsMatchHead(cbContext *CloudBuildContext, repoPath string, buildTargetId string, buildNumber int64, all bool) (bool, error) {
+	return NewClient(cbContext).Git_BuildsMatchHead(context.Background(), repoPath, buildTargetId, buildNumber, all)
+}
+
+// Deprecated: Use Client.Git_Head.
+func Git_Head(cbContext *CloudBuildContext, repoPath string) (*GitCommit, error) {
+	result, err := NewClient(cbContext).Git_Head(repoPath)
+	printResult(cbContext, result, err)
+	return result, err
+}
+
+// Deprecated: Use Client.Builds_WaitForComplete.
+func Builds_WaitForComplete(cbContext *CloudBuildContext, buildTargetId string, buildNumber int64, all bool, abortOnFail bool) error {
+	return NewClient(cbContext).Builds_WaitForComplete(context.Background(), buildTargetId, buildNumber, all, WaitOptions{AbortOnFail: abortOnFail})
+}
+
+// Deprecated: Use Client.Builds_Download.
+func Builds_Download(cbContext *CloudBuildContext, buildTargetId string, buildNumber int64, latest bool, outputDir string, unzip bool) error {
+	_, err := NewClient(cbContext).Builds_Download(context.Background(), buildTargetId, buildNumber, DownloadOptions{Latest: latest, OutputDir: outputDir, Unzip: unzip})
+	return err
+}
+
+// Deprecated: Use Client.Builds_Start.
+func Builds_Start(cbContext *CloudBuildContext, buildTargetId string, clean bool) (*BuildAttempt, error) {
+	result, err := NewClient(cbContext).Builds_Start(context.Background(), buildTargetId, StartOptions{Clean: clean})
+	printResult(cbContext, result, err)
+	return result, err
+}
+
+// Deprecated: Use Client.Builds_StartAll.
+func Builds_StartAll(cbContext *CloudBuildContext, clean bool) ([]BuildAttempt, error) {
+	result, err := NewClient(cbContext).Builds_StartAll(context.Background(), StartOptions{Clean: clean})
+	printResult(cbContext, result, err)
+	return result, err
+}
+
+// Deprecated: Use Client.Builds_Cancel.
+func Builds_Cancel(cbContext *CloudBuildContext, buildTargetId string, buildNumber int64) error {
+	return NewClient(cbContext).Builds_Cancel(context.Background(), buildTargetId, buildNumber)
+}
+
+// Deprecated: Use Client.Builds_CancelAll.
+func Builds_CancelAll(cbContext *CloudBuildContext, buildTargetId string) error {
+	return NewClient(cbContext).Builds_CancelAll(context.Background(), buildTargetId)
+}
+
+// Deprecated: Use Client.Builds_Status.
+func Builds_Status(cbContext *CloudBuildContext, buildTargetId string, buildNumber int64) (*Build, error) {
+	result, err := NewClient(cbContext).Builds_Status(context.Background(), buildTargetId, buildNumber)
+	printResult(cbContext, result, err)
+	return result, err
+}
+
+// Deprecated: Use Client.Builds_List.
+func Builds_List(cbContext *CloudBuildContext, buildTargetId string, filterStatus string, filterPlatform string, limit int64) ([]Build, error) {
+	result, err := NewClient(cbContext).Builds_List(context.Background(), buildTargetId, filterStatus, filterPlatform, limit)
+	printResult(cbContext, result, err)
+	return result, err
+}
+
+// Deprecated: Use Client.Builds_Latest.
+func Builds_Latest(cbContext *CloudBuildContext, onlySuccess bool, onlyEnabled bool) (map[string]*Build, error) {
+	result, err := NewClient(cbContext).Builds_Latest(context.Background(), onlySuccess, onlyEnabled)
+	printResult(cbContext, result, err)
+	return result, err
+}
+
+// Deprecated: Use Client.Targets_List.
+func Targets_List(cbContext *CloudBuildContext) ([]BuildTarget, error) {
+	result, err := NewClient(cbContext).Targets_List(context.Background())
+	printResult(cbContext, result, err)
+	return result, err
+}
@@ -0,0 +1,620 @@
+package unitycloudbuild
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+type DownloadOptions struct {
+	// Latest downloads the latest successful build instead of a specific build number.
+	Latest bool
+
+	// OutputDir defaults to the current directory.
+	OutputDir string
+
+	// Unzip extracts archives (see RegisterExtractor) into OutputDir instead
+	// of saving them. Mobile packages (.ipa, .apk, .aab) are always saved.
+	Unzip bool
+
+	// Clean removes the existing contents of OutputDir before extracting. The
+	// download completes before anything is removed.
+	Clean bool
+
+	// Artifact selects an artifact by key, e.g. "symbols". If empty the
+	// primary download is used.
+	Artifact string
+
+	// FileGlob filters the files of Artifact by filename, e.g. "*.zip".
+	FileGlob string
+
+	// Resume keeps partially downloaded .part files when a download fails and
+	// continues from them on the next attempt. It only applies to downloads
+	// over a single connection: with Connections > 1 the .part file is
+	// removed on failure, but an existing one is resumed over one connection.
+	Resume bool
+
+	// Cache, if set, is checked before downloading a file, and downloaded
+	// files are stored in it.
+	Cache *DownloadCache
+
+	// CacheDir is where archives are downloaded to with Resume, in its
+	// partial subdirectory. Defaults to the directory of Cache if set,
+	// otherwise DefaultCacheDir.
+	CacheDir string
+
+	// Manifest writes a BuildManifest to OutputDir once all files have been
+	// downloaded.
+	Manifest bool
+
+	// Connections is the number of parallel connections used to download each
+	// file. Values above 1 split the file into ranges that are fetched
+	// concurrently, if the server supports range requests.
+	Connections int
+
+	// Progress is called periodically during each file download. If nil and
+	// the output format is human, a progress bar is written to stderr.
+	Progress ProgressFunc
+}
+
+type DownloadAction string
+
+const (
+	DownloadAction_Saved     DownloadAction = "saved"
+	DownloadAction_Extracted DownloadAction = "extracted"
+)
+
+// DownloadedFile describes what Builds_Download did with a file.
+type DownloadedFile struct {
+	Filename string         `json:"filename"`
+	Type     string         `json:"type"`
+	Size     int64          `json:"size"`
+	Action   DownloadAction `json:"action"`
+
+	// URL is where the file was downloaded from, without the query string
+	// which holds an expiring signature.
+	URL string `json:"url"`
+
+	// Path is the saved file, or the directory an archive was extracted to.
+	Path string `json:"path"`
+
+	// Cached is true if the file was not downloaded, but taken from
+	// DownloadOptions.Cache.
+	Cached bool `json:"cached,omitempty"`
+
+	// Package is set for mobile packages whose metadata could be read.
+	Package *PackageInfo `json:"package,omitempty"`
+
+	// written are the paths of the files that were saved or extracted, for
+	// the build manifest.
+	written []string
+}
+
+// Builds_Download downloads the primary download or artifact files of a
+// build. Depending on their type and options.Unzip, files are saved,
+// extracted or saved and inspected (see InspectPackage).
+func (c *Client) Builds_Download(ctx context.Context, buildTargetId string, buildNumber int64, options DownloadOptions) ([]DownloadedFile, error) {
+	// Find the build information
+	var build *Build
+	var err error
+
+	if !options.Latest {
+		build, err = c.Builds_Status(ctx, buildTargetId, buildNumber)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		targetBuilds, err := c.Builds_List(ctx, buildTargetId, "success", "", 1)
+		if err != nil {
+			return nil, err
+		} else if len(targetBuilds) == 0 {
+			return nil, fmt.Errorf("No successful build for target %s", buildTargetId)
+		}
+
+		build = &targetBuilds[0]
+
+		if c.Context.OutputFormat == OutputFormat_Human {
+			fmt.Printf("Latest build is #%d.\n", build.Number)
+		}
+	}
+
+	if c.Context.Verbose {
+		log.Printf("Found build #%d for target %s, status: %s", build.Number, build.TargetId, build.Status)
+	}
+
+	if build.Status != "success" {
+		return nil, fmt.Errorf("Cannot download build, status is '%s'", build.Status)
+	}
+
+	files, err := downloadFiles(build, options.Artifact, options.FileGlob)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Clean && !options.Unzip {
+		return nil, fmt.Errorf("Clean can only be used when unzipping")
+	}
+
+	for _, file := range files {
+		if options.Unzip && ExtractorFor(file.Type) == nil && !IsPackageType(file.Type) {
+			return nil, fmt.Errorf("Cannot unzip %s, filetype %s is not supported", file.Filename, file.Type)
+		}
+	}
+
+	// Check output dir status
+	outputDir := options.OutputDir
+	if len(outputDir) == 0 {
+		outputDir = "."
+	}
+
+	outputDirInfo, err := os.Stat(outputDir)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("Error: %s does not exist", outputDir)
+	} else if err != nil {
+		return nil, fmt.Errorf("Error stat'ing directory: %v", err)
+	} else if !outputDirInfo.IsDir() {
+		return nil, fmt.Errorf("Error: %s is not a directory", outputDir)
+	}
+
+	var downloaded []DownloadedFile
+	cleaned := false
+
+	for _, file := range files {
+		// Only clean before extracting the first archive
+		fileOptions := options
+		fileOptions.Clean = options.Clean && !cleaned && ExtractorFor(file.Type) != nil
+		cleaned = cleaned || fileOptions.Clean
+
+		result, err := c.downloadFile(ctx, build, file, outputDir, fileOptions)
+		if err != nil {
+			return downloaded, err
+		}
+		downloaded = append(downloaded, *result)
+	}
+
+	if options.Manifest {
+		filename, err := writeBuildManifest(outputDir, build, options.Artifact, downloaded)
+		if err != nil {
+			return downloaded, err
+		}
+
+		if c.Context.OutputFormat == OutputFormat_Human {
+			fmt.Printf("Wrote manifest: %s\n", filename)
+		}
+	}
+
+	return downloaded, nil
+}
+
+// Builds_Artifacts returns the artifacts of a build, each with its files.
+func (c *Client) Builds_Artifacts(ctx context.Context, buildTargetId string, buildNumber int64) ([]Artifact, error) {
+	build, err := c.Builds_Status(ctx, buildTargetId, buildNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	return build.Links.Artifacts, nil
+}
+
+type downloadFile struct {
+	Filename string
+	Type     string
+	URL      *url.URL
+	Size     int64
+	MD5      string
+}
+
+// downloadFiles determines which files to download for a build, either the
+// primary download or the files of the artifact with the given key.
+func downloadFiles(build *Build, artifactKey string, fileGlob string) ([]downloadFile, error) {
+	if len(artifactKey) == 0 {
+		if build.Links.DownloadPrimary == nil {
+			return nil, fmt.Errorf("Missing download link for build")
+		}
+
+		_url, err := url.Parse(build.Links.DownloadPrimary.Href)
+		if err != nil {
+			return nil, err
+		}
+
+		filename := path.Base(_url.Path)
+		if _, params, err := mime.ParseMediaType(_url.Query().Get("response-content-disposition")); err == nil {
+			filename = params["filename"]
+		}
+
+		fileType := FileType(filename)
+		if len(fileType) == 0 {
+			fileType = strings.ToLower(build.Links.DownloadPrimary.Meta.Type)
+		}
+
+		return []downloadFile{{
+			Filename: filename,
+			Type:     fileType,
+			URL:      _url,
+		}}, nil
+	}
+
+	var artifact *Artifact
+	for i := range build.Links.Artifacts {
+		if build.Links.Artifacts[i].Key == artifactKey {
+			artifact = &build.Links.Artifacts[i]
+			break
+		}
+	}
+
+	if artifact == nil {
+		return nil, fmt.Errorf("Build %s #%d has no artifact '%s'", build.TargetId, build.Number, artifactKey)
+	}
+
+	var files []downloadFile
+	for _, file := range artifact.Files {
+		if len(fileGlob) > 0 {
+			if matched, err := path.Match(fileGlob, file.Filename); err != nil {
+				return nil, err
+			} else if !matched {
+				continue
+			}
+		}
+
+		_url, err := url.Parse(file.Href)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, downloadFile{
+			Filename: path.Base(file.Filename),
+			Type:     FileType(file.Filename),
+			URL:      _url,
+			Size:     file.Size,
+			MD5:      file.MD5Sum,
+		})
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("No files in artifact '%s' match '%s'", artifactKey, fileGlob)
+	}
+
+	return files, nil
+}
+
+func (c *Client) downloadFile(ctx context.Context, build *Build, download downloadFile, outputDir string, options DownloadOptions) (*DownloadedFile, error) {
+	extractor := ExtractorFor(download.Type)
+	if !options.Unzip {
+		extractor = nil
+	}
+
+	filename := filepath.Join(outputDir, download.Filename)
+	if extractor != nil {
+		var cleanup func()
+		var err error
+		if filename, cleanup, err = archivePath(build, download.Filename, options); err != nil {
+			return nil, err
+		}
+		defer cleanup()
+	} else if c.Context.Verbose {
+		log.Printf("Using filename: %s\n", download.Filename)
+	}
+
+	// With a cache, the file is downloaded into the cache and copied or
+	// extracted from there
+	source := filename
+	cached := false
+	if options.Cache != nil && len(build.GUID) > 0 {
+		source, cached = options.Cache.lookup(build, download.Filename)
+		if !cached {
+			source = options.Cache.path(build, download.Filename)
+			if err := os.MkdirAll(filepath.Dir(source), 0755); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if cached {
+		if c.Context.OutputFormat == OutputFormat_Human {
+			fmt.Printf("Using cached download: %s\n", source)
+		}
+	} else {
+		if c.Context.OutputFormat == OutputFormat_Human {
+			fmt.Printf("Downloading to: %s\n", source)
+		}
+
+		if err := c.fetch(ctx, download, source, options); err != nil {
+			return nil, err
+		}
+
+		if c.Context.OutputFormat == OutputFormat_Human {
+			fmt.Printf("Download complete.\n")
+		}
+
+		if source != filename {
+			if err := options.Cache.store(build, download.Filename); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	downloadURL := *download.URL
+	downloadURL.RawQuery = ""
+
+	result := &DownloadedFile{
+		Filename: download.Filename,
+		Type:     download.Type,
+		Action:   DownloadAction_Saved,
+		URL:      downloadURL.String(),
+		Path:     filename,
+		Cached:   cached,
+	}
+
+	if info, err := os.Stat(source); err == nil {
+		result.Size = info.Size()
+	}
+
+	if extractor != nil {
+		if err := c.extract(ctx, extractor, source, outputDir, options.Clean, func(path string) {
+			result.written = append(result.written, path)
+		}); err != nil {
+			return nil, err
+		}
+
+		result.Action = DownloadAction_Extracted
+		result.Path = outputDir
+		return result, nil
+	}
+
+	if source != filename {
+		if c.Context.OutputFormat == OutputFormat_Human {
+			fmt.Printf("Copying to: %s\n", filename)
+		}
+		if err := copyFile(source, filename); err != nil {
+			return nil, err
+		}
+	}
+
+	if IsPackageType(download.Type) {
+		// Failing to read the metadata does not make the download unusable
+		var err error
+		if result.Package, err = InspectPackage(filename, download.Type); err != nil && c.Context.Verbose {
+			log.Printf("Could not inspect %s: %v", filename, err)
+		}
+	}
+
+	result.written = []string{filename}
+	return result, nil
+}
+
+// archivePath returns where an archive is downloaded to before it is
+// extracted, and a function that removes it afterwards. Resumable downloads
+// go to a path in the cache directory that stays the same between runs, so
+// that a later run finds the .part file. Others go to a new private temp
+// directory, so that concurrent downloads of the same file cannot overwrite
+// each other.
+func archivePath(build *Build, filename string, options DownloadOptions) (string, func(), error) {
+	if !options.Resume {
+		dir, err := ioutil.TempDir("", "unity-cb-tool-")
+		if err != nil {
+			return "", nil, err
+		}
+		return filepath.Join(dir, filename), func() { os.RemoveAll(dir) }, nil
+	}
+
+	cacheDir := options.CacheDir
+	if len(cacheDir) == 0 && options.Cache != nil {
+		cacheDir = options.Cache.Dir
+	}
+	if len(cacheDir) == 0 {
+		var err error
+		if cacheDir, err = DefaultCacheDir(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	dir := filepath.Join(cacheDir, "partial")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", nil, err
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%s-%d-%s", url.PathEscape(build.TargetId), build.Number, filename))
+	return path, func() { os.Remove(path) }, nil
+}
+
+// fetch downloads a file to filename, using a progress bar in human output
+// mode unless options.Progress is set.
+func (c *Client) fetch(ctx context.Context, download downloadFile, filename string, options DownloadOptions) error {
+	progress := options.Progress
+	if progress == nil && c.Context.OutputFormat == OutputFormat_Human {
+		progress = NewProgressBar(os.Stderr)
+	}
+
+	if options.Connections > 1 {
+		return c.fetchFileParallel(ctx, download, filename, options.Connections, options.Resume, progress)
+	}
+	return c.fetchFile(ctx, download, filename, options.Resume, progress)
+}
+
+// extract extracts a downloaded archive, calling onFile with each file and
+// reporting it in human output mode.
+func (c *Client) extract(ctx context.Context, extractor Extractor, filename string, outputDir string, clean bool, onFile func(path string)) error {
+	human := c.Context.OutputFormat == OutputFormat_Human
+	if human {
+		if clean {
+			fmt.Printf("Removing existing content of: %s\n", outputDir)
+		}
+		fmt.Printf("Extracting content to: %s\n", outputDir)
+	}
+
+	options := ExtractOptions{Clean: clean}
+	options.OnFile = func(path string) {
+		if human {
+			fmt.Println("Writing:", path)
+		}
+		onFile(path)
+	}
+
+	return extractor.Extract(ctx, filename, outputDir, options)
+}
+
+// DownloadAllOptions configures Builds_DownloadAll. OutputDir is a
+// text/template executed with each *Build, e.g. "dist/{{.TargetId}}", and
+// Latest is ignored.
+type DownloadAllOptions struct {
+	DownloadOptions
+
+	// Workers is the number of builds downloaded concurrently, defaults to
+	// DefaultDownloadWorkers.
+	Workers int
+}
+
+const DefaultDownloadWorkers = 4
+
+// TargetDownload is the result of downloading the build of a target.
+type TargetDownload struct {
+	TargetId  string           `json:"buildTargetId"`
+	Build     *Build           `json:"build,omitempty"`
+	OutputDir string           `json:"outputDir,omitempty"`
+	Files     []DownloadedFile `json:"files,omitempty"`
+	Error     string           `json:"error,omitempty"`
+}
+
+// Builds_DownloadAll downloads the latest successful build of every enabled
+// target into its own directory. A failure for one target is recorded in its
+// TargetDownload and does not stop the others, an error is only returned if
+// the builds cannot be listed or the options are invalid.
+func (c *Client) Builds_DownloadAll(ctx context.Context, options DownloadAllOptions) ([]TargetDownload, error) {
+	// Check the template before listing builds
+	if _, err := template.New("output").Parse(options.OutputDir); err != nil {
+		return nil, err
+	}
+
+	latest, err := c.Builds_Latest(ctx, true, true)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]TargetDownload, 0, len(latest))
+	for _, targetId := range sortedBuildKeys(latest) {
+		result := TargetDownload{TargetId: targetId, Build: latest[targetId]}
+		if result.Build == nil {
+			result.Error = "No successful build"
+		}
+		results = append(results, result)
+	}
+
+	return c.downloadTargets(ctx, results, options)
+}
+
+// Builds_DownloadBuilds is like Builds_DownloadAll, but downloads the given
+// builds instead of the latest successful ones.
+func (c *Client) Builds_DownloadBuilds(ctx context.Context, builds []*Build, options DownloadAllOptions) ([]TargetDownload, error) {
+	results := make([]TargetDownload, len(builds))
+	for i, build := range builds {
+		results[i] = TargetDownload{TargetId: build.TargetId, Build: build}
+	}
+
+	return c.downloadTargets(ctx, results, options)
+}
+
+// downloadTargets downloads the build of each result that does not already
+// have an error.
+func (c *Client) downloadTargets(ctx context.Context, results []TargetDownload, options DownloadAllOptions) ([]TargetDownload, error) {
+	outputTemplate, err := template.New("output").Parse(options.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	outputDirs := make(map[string]string)
+
+	for i := range results {
+		result := &results[i]
+		if len(result.Error) > 0 {
+			continue
+		}
+
+		var outputDir strings.Builder
+		if err := outputTemplate.Execute(&outputDir, result.Build); err != nil {
+			return nil, err
+		}
+		result.OutputDir = outputDir.String()
+
+		// Targets downloaded concurrently into the same directory would
+		// overwrite each other's files
+		dir := filepath.Clean(result.OutputDir)
+		if other, ok := outputDirs[dir]; ok {
+			return nil, fmt.Errorf("Targets %s and %s have the same output directory %s, use a template such as 'dist/{{.TargetId}}'", other, result.TargetId, dir)
+		}
+		outputDirs[dir] = result.TargetId
+	}
+
+	workers := options.Workers
+	if workers <= 0 {
+		workers = DefaultDownloadWorkers
+	}
+
+	// Progress bars of concurrent downloads would overwrite each other
+	downloadOptions := options.DownloadOptions
+	downloadOptions.Latest = false
+	if downloadOptions.Progress == nil && workers > 1 {
+		downloadOptions.Progress = func(DownloadProgress) {}
+	}
+
+	queue := make(chan *TargetDownload)
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for result := range queue {
+				c.downloadTarget(ctx, result, downloadOptions)
+			}
+		}()
+	}
+
+	for i := range results {
+		if len(results[i].Error) == 0 {
+			queue <- &results[i]
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	return results, nil
+}
+
+func (c *Client) downloadTarget(ctx context.Context, result *TargetDownload, options DownloadOptions) {
+	if err := ctx.Err(); err != nil {
+		result.Error = err.Error()
+		return
+	}
+
+	if len(result.OutputDir) > 0 {
+		if err := os.MkdirAll(result.OutputDir, 0755); err != nil {
+			result.Error = err.Error()
+			return
+		}
+	}
+
+	options.OutputDir = result.OutputDir
+
+	files, err := c.Builds_Download(ctx, result.TargetId, int64(result.Build.Number), options)
+	result.Files = files
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	if c.Context.OutputFormat == OutputFormat_Human {
+		if err != nil {
+			fmt.Printf("Failed to download %s #%d: %v\n", result.TargetId, result.Build.Number, err)
+		} else {
+			fmt.Printf("Downloaded %s #%d to %s\n", result.TargetId, result.Build.Number, result.OutputDir)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package unitycloudbuild
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloadBuildsRejectsSharedOutputDir(t *testing.T) {
+	builds := []*Build{{TargetId: "android", Number: 1}, {TargetId: "ios", Number: 2}}
+
+	for _, outputDir := range []string{"", ".", "dist", "dist/{{if .Number}}all{{end}}"} {
+		_, err := newTestClient().Builds_DownloadBuilds(context.Background(), builds, DownloadAllOptions{
+			DownloadOptions: DownloadOptions{OutputDir: outputDir, Unzip: true},
+		})
+		if err == nil || !strings.Contains(err.Error(), "same output directory") {
+			t.Errorf("Expected output dir %q to be rejected, got %v", outputDir, err)
+		}
+	}
+}
+
+func TestDownloadRejectsBadOutputDir(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"build":1,"buildtargetid":"android","buildStatus":"success","links":{"download_primary":{"href":"https://example.com/build.apk","meta":{"type":"APK"}}}}`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient()
+	c.BaseURL = srv.URL
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"missing":       filepath.Join(dir, "missing"),
+		"file":          file,
+		"inside a file": filepath.Join(file, "dir"),
+	}
+
+	for name, outputDir := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := c.Builds_Download(context.Background(), "android", 1, DownloadOptions{OutputDir: outputDir})
+			if err == nil || !strings.Contains(err.Error(), outputDir) {
+				t.Errorf("Expected an error for %s, got %v", outputDir, err)
+			}
+		})
+	}
+}
+
+func TestArchivePath(t *testing.T) {
+	build := &Build{TargetId: "android", Number: 3}
+	cacheDir := t.TempDir()
+
+	cases := map[string]struct {
+		Options DownloadOptions
+		Dir     string
+	}{
+		"cache dir":       {DownloadOptions{Resume: true, CacheDir: cacheDir}, filepath.Join(cacheDir, "partial")},
+		"cache":           {DownloadOptions{Resume: true, Cache: &DownloadCache{Dir: cacheDir}}, filepath.Join(cacheDir, "partial")},
+		"cache dir first": {DownloadOptions{Resume: true, CacheDir: cacheDir, Cache: &DownloadCache{Dir: "elsewhere"}}, filepath.Join(cacheDir, "partial")},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			path, cleanup, err := archivePath(build, "build.zip", tc.Options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cleanup()
+
+			if expected := filepath.Join(tc.Dir, "android-3-build.zip"); path != expected {
+				t.Errorf("Expected %s, got %s", expected, path)
+			}
+		})
+	}
+
+	t.Run("no resume", func(t *testing.T) {
+		path, cleanup, err := archivePath(build, "build.zip", DownloadOptions{CacheDir: cacheDir})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.HasPrefix(path, cacheDir) || filepath.Base(path) != "build.zip" {
+			t.Errorf("Expected a temp path, got %s", path)
+		}
+		cleanup()
+		if _, err := os.Stat(filepath.Dir(path)); !os.IsNotExist(err) {
+			t.Errorf("Expected the temp dir to be removed, got %v", err)
+		}
+	})
+}
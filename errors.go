@@ -0,0 +1,188 @@
+package unitycloudbuild
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var RateLimitedError = fmt.Errorf("API rate limit reached")
+var ResourceNotFoundError = fmt.Errorf("Resource not found")
+
+// APIError is returned for any non-successful response from the Cloud Build
+// API. It matches RateLimitedError and ResourceNotFoundError via errors.Is.
+type APIError struct {
+	StatusCode int
+	Method     string
+	Path       string
+	Message    string
+	Body       []byte
+	Header     http.Header
+
+	// RateLimitRemaining is -1 if the response did not include the header.
+	RateLimitRemaining int
+	RateLimitReset     time.Time
+	RetryAfter         time.Duration
+}
+
+func newAPIError(req *http.Request, resp *http.Response, body []byte) *APIError {
+	var e errorMessage
+	json.Unmarshal(body, &e)
+
+	apiErr := &APIError{
+		StatusCode:         resp.StatusCode,
+		Method:             req.Method,
+		Path:               req.URL.Path,
+		Message:            e.Error,
+		Body:               body,
+		Header:             resp.Header,
+		RateLimitRemaining: -1,
+	}
+
+	rateLimit := parseRateLimit(resp.Header)
+	apiErr.RateLimitRemaining = rateLimit.Remaining
+	apiErr.RateLimitReset = rateLimit.Reset
+
+	if v := resp.Header.Get("Retry-After"); len(v) > 0 {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		} else if t, err := http.ParseTime(v); err == nil {
+			apiErr.RetryAfter = time.Until(t)
+		}
+	}
+
+	return apiErr
+}
+
+func (e *APIError) Error() string {
+	message := e.Message
+	if len(message) == 0 {
+		message = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("[HTTP %d] %s %s: %s", e.StatusCode, e.Method, e.Path, message)
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case RateLimitedError:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ResourceNotFoundError:
+		return e.StatusCode == http.StatusNotFound
+	default:
+		return false
+	}
+}
+
+// IsServerError returns true for 5xx responses.
+func (e *APIError) IsServerError() bool {
+	return e.StatusCode >= 500 && e.StatusCode <= 599
+}
+
+// DecodeError is returned when an API response body could not be decoded.
+type DecodeError struct {
+	Body []byte
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("Could not decode response: %v", e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// InvalidPlatformError is returned when a platform filter is not a known
+// platform or shorthand.
+type InvalidPlatformError struct {
+	Platform string
+}
+
+func (e *InvalidPlatformError) Error() string {
+	return fmt.Sprintf("No such platform: %s", e.Platform)
+}
+
+// GitError is returned when the local Git repository could not be read. Op
+// describes the step that failed (e.g. "open", "head").
+type GitError struct {
+	Op  string
+	Err error
+}
+
+func (e *GitError) Error() string {
+	return fmt.Sprintf("Git %s failed: %v", e.Op, e.Err)
+}
+
+func (e *GitError) Unwrap() error {
+	return e.Err
+}
+
+// NotPushedError is returned when a revision cannot be built because it is
+// not on the branch that a target builds from.
+type NotPushedError struct {
+	Revision string
+	Branch   string
+	TargetId string
+}
+
+func (e *NotPushedError) Error() string {
+	return fmt.Sprintf("Revision %s is not on branch %s built by target %s, push it first (or fetch, if it was pushed from elsewhere)", e.Revision, e.Branch, e.TargetId)
+}
+
+// ChecksumError is returned when a downloaded file does not match the
+// expected size or checksum.
+type ChecksumError struct {
+	Filename string
+	Kind     string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("Downloaded %s does not match, expected %s %s, got %s", e.Filename, e.Kind, e.Expected, e.Actual)
+}
+
+// UnsafePathError is returned when an archive entry would be extracted outside
+// of the output directory by its name, or is a symlink pointing outside of it.
+type UnsafePathError struct {
+	Name string
+
+	// Target is set if the entry is a symlink.
+	Target string
+}
+
+func (e *UnsafePathError) Error() string {
+	if len(e.Target) > 0 {
+		return fmt.Sprintf("Refusing to extract %s, it links to %s outside of the output directory", e.Name, e.Target)
+	}
+	return fmt.Sprintf("Refusing to extract %s, it is outside of the output directory", e.Name)
+}
+
+// WaitTimeoutError is returned by Builds_WaitForComplete when builds did not
+// finish in time. Reason is "timeout", "queue timeout" or "stall timeout".
+// Builds are the builds that timed out, in their last known state.
+type WaitTimeoutError struct {
+	Reason  string
+	Timeout time.Duration
+	Builds  []*Build
+
+	// CancelErrors are the failures to cancel Builds with
+	// WaitOptions.CancelOnTimeout. Those builds may still be running.
+	CancelErrors []error
+}
+
+func (e *WaitTimeoutError) Error() string {
+	names := make([]string, len(e.Builds))
+	for i, build := range e.Builds {
+		names[i] = fmt.Sprintf("%s #%d (%s)", build.TargetId, build.Number, build.Status)
+	}
+	msg := fmt.Sprintf("Exceeded %s of %v waiting for %s", e.Reason, e.Timeout, strings.Join(names, ", "))
+
+	for _, err := range e.CancelErrors {
+		msg += "; " + err.Error()
+	}
+	return msg
+}
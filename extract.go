@@ -0,0 +1,537 @@
+package unitycloudbuild
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ExtractOptions struct {
+	// Clean removes the existing contents of the output directory before
+	// extracting.
+	Clean bool
+
+	// OnFile is called with the path of each file as it is extracted.
+	OnFile func(path string)
+}
+
+// Extractor extracts an archive into outputDir. Implementations must reject
+// entries that would be written outside of outputDir.
+type Extractor interface {
+	Extract(ctx context.Context, filename string, outputDir string, options ExtractOptions) error
+}
+
+var (
+	extractorsMu sync.RWMutex
+	extractors   = map[string]Extractor{
+		"zip":    ZipExtractor{},
+		"tar.gz": TarGzExtractor{},
+	}
+)
+
+// RegisterExtractor sets the Extractor used for downloads of fileType, e.g.
+// "zip" or "tar.gz", replacing any existing one.
+func RegisterExtractor(fileType string, extractor Extractor) {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+	extractors[strings.ToLower(fileType)] = extractor
+}
+
+// ExtractorFor returns the Extractor registered for fileType, or nil.
+func ExtractorFor(fileType string) Extractor {
+	extractorsMu.RLock()
+	defer extractorsMu.RUnlock()
+	return extractors[strings.ToLower(fileType)]
+}
+
+// FileType determines the type of a file from its name, e.g. "zip", "tar.gz"
+// or "apk".
+func FileType(filename string) string {
+	name := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tar.gz"
+	default:
+		return strings.TrimPrefix(filepath.Ext(name), ".")
+	}
+}
+
+// ZipExtractor extracts zip archives. Symlinks, permission bits and
+// modification times are preserved.
+type ZipExtractor struct{}
+
+func (ZipExtractor) Extract(ctx context.Context, filename string, outputDir string, options ExtractOptions) error {
+	zipReader, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer zipReader.Close()
+
+	e, err := newExtraction(outputDir, options)
+	if err != nil {
+		return err
+	}
+
+	for _, zippedFile := range zipReader.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := extractZipEntry(e, zippedFile); err != nil {
+			return err
+		}
+	}
+
+	return e.finish(ctx)
+}
+
+func extractZipEntry(e *extraction, zippedFile *zip.File) error {
+	mode := zippedFile.Mode()
+	if mode.IsDir() {
+		return e.dir(zippedFile.Name, mode, zippedFile.Modified)
+	}
+
+	fileReader, err := zippedFile.Open()
+	if err != nil {
+		return err
+	}
+	defer fileReader.Close()
+
+	if mode&os.ModeSymlink != 0 {
+		// The link target is stored as the content of the entry
+		target, err := ioutil.ReadAll(io.LimitReader(fileReader, 4096))
+		if err != nil {
+			return err
+		}
+		return e.symlink(zippedFile.Name, string(target))
+	}
+
+	return e.file(zippedFile.Name, fileReader, mode, zippedFile.Modified)
+}
+
+// TarGzExtractor extracts gzip compressed tar archives. Symlinks, hard links,
+// permission bits and modification times are preserved.
+type TarGzExtractor struct{}
+
+func (TarGzExtractor) Extract(ctx context.Context, filename string, outputDir string, options ExtractOptions) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	e, err := newExtraction(outputDir, options)
+	if err != nil {
+		return err
+	}
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		mode := header.FileInfo().Mode()
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = e.dir(header.Name, mode, header.ModTime)
+		case tar.TypeSymlink:
+			err = e.symlink(header.Name, header.Linkname)
+		case tar.TypeLink:
+			err = e.hardlink(header.Name, header.Linkname)
+		case tar.TypeReg, tar.TypeRegA:
+			err = e.file(header.Name, tarReader, mode, header.ModTime)
+		default:
+			// Devices and fifos have no place in a build
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return e.finish(ctx)
+}
+
+type pendingSymlink struct {
+	Path   string
+	Target string
+}
+
+// extraction writes the entries of an archive below outputDir. Symlinks are
+// created last so that no file is ever written through one, and directory
+// times are restored once their contents have been written.
+type extraction struct {
+	outputDir string
+	options   ExtractOptions
+	symlinks  []pendingSymlink
+	dirTimes  map[string]time.Time
+}
+
+func newExtraction(outputDir string, options ExtractOptions) (*extraction, error) {
+	if options.Clean {
+		if err := cleanDir(outputDir); err != nil {
+			return nil, err
+		}
+	}
+
+	return &extraction{
+		outputDir: outputDir,
+		options:   options,
+		dirTimes:  make(map[string]time.Time),
+	}, nil
+}
+
+func (e *extraction) dir(name string, mode os.FileMode, modified time.Time) error {
+	dirPath, err := safeJoin(e.outputDir, name)
+	if err != nil {
+		return err
+	}
+
+	if err := mkdirSafe(e.outputDir, dirPath, dirPerm(mode)); err != nil {
+		return err
+	}
+
+	e.dirTimes[dirPath] = modified
+	return nil
+}
+
+func (e *extraction) file(name string, r io.Reader, mode os.FileMode, modified time.Time) error {
+	filePath, err := safeJoin(e.outputDir, name)
+	if err != nil {
+		return err
+	}
+
+	if e.options.OnFile != nil {
+		e.options.OnFile(filePath)
+	}
+
+	if err := e.prepare(filePath); err != nil {
+		return err
+	}
+
+	perm := mode.Perm()
+	if perm == 0 {
+		// Archives created on Windows have no permission bits
+		perm = 0644
+	}
+
+	targetFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(targetFile, r); err != nil {
+		targetFile.Close()
+		return err
+	}
+
+	if err := targetFile.Close(); err != nil {
+		return err
+	}
+
+	// OpenFile does not change the mode of an existing file, and is subject
+	// to the umask
+	if err := os.Chmod(filePath, perm); err != nil {
+		return err
+	}
+
+	if !modified.IsZero() {
+		return os.Chtimes(filePath, modified, modified)
+	}
+	return nil
+}
+
+// symlink validates a symlink and queues it to be created by finish, which
+// also checks that it does not escape through other links.
+func (e *extraction) symlink(name string, target string) error {
+	linkPath, err := safeJoin(e.outputDir, name)
+	if err != nil {
+		return err
+	}
+
+	linkTarget := filepath.FromSlash(target)
+	if filepath.IsAbs(linkTarget) {
+		return &UnsafePathError{Name: name, Target: target}
+	}
+
+	if _, err := safeJoin(e.outputDir, filepath.Join(filepath.Dir(relPath(e.outputDir, linkPath)), linkTarget)); err != nil {
+		return &UnsafePathError{Name: name, Target: target}
+	}
+
+	e.symlinks = append(e.symlinks, pendingSymlink{Path: linkPath, Target: linkTarget})
+	return nil
+}
+
+func (e *extraction) hardlink(name string, target string) error {
+	linkPath, err := safeJoin(e.outputDir, name)
+	if err != nil {
+		return err
+	}
+
+	targetPath, err := safeJoin(e.outputDir, target)
+	if err != nil {
+		return &UnsafePathError{Name: name, Target: target}
+	}
+
+	// os.Link follows symlinks in the directories of the target, which may
+	// remain from a previous extraction into outputDir
+	if !e.resolvesInside(nil, filepath.Dir(relPath(e.outputDir, targetPath))) {
+		return &UnsafePathError{Name: name, Target: target}
+	}
+
+	if e.options.OnFile != nil {
+		e.options.OnFile(linkPath)
+	}
+
+	if err := e.prepare(linkPath); err != nil {
+		return err
+	} else if err := os.Remove(linkPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.Link(targetPath, linkPath)
+}
+
+// prepare creates the parent directories of path and removes an existing
+// symlink at path, so that it is replaced instead of written through.
+func (e *extraction) prepare(path string) error {
+	if err := mkdirSafe(e.outputDir, filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return os.Remove(path)
+	}
+	return nil
+}
+
+func (e *extraction) finish(ctx context.Context) error {
+	// A link may only escape through links queued after it, so they are all
+	// checked before any of them is created
+	links := make(map[string]string, len(e.symlinks))
+	for _, link := range e.symlinks {
+		links[relPath(e.outputDir, link.Path)] = link.Target
+	}
+
+	for _, link := range e.symlinks {
+		rel := relPath(e.outputDir, link.Path)
+		// Not filepath.Join, which would clean the target lexically
+		if !e.resolvesInside(links, filepath.Dir(rel)+string(filepath.Separator)+link.Target) {
+			return &UnsafePathError{Name: filepath.ToSlash(rel), Target: filepath.ToSlash(link.Target)}
+		}
+	}
+
+	for _, link := range e.symlinks {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if e.options.OnFile != nil {
+			e.options.OnFile(link.Path)
+		}
+
+		if err := mkdirSafe(e.outputDir, filepath.Dir(link.Path), 0755); err != nil {
+			return err
+		}
+
+		if info, err := os.Lstat(link.Path); err == nil {
+			if info.IsDir() {
+				return fmt.Errorf("Cannot create symlink %s, a directory exists at its path", link.Path)
+			} else if err := os.Remove(link.Path); err != nil {
+				return err
+			}
+		}
+
+		if err := os.Symlink(link.Target, link.Path); err != nil {
+			return err
+		}
+	}
+
+	// Deepest directories first so that parents are not touched afterwards
+	dirs := make([]string, 0, len(e.dirTimes))
+	for dir := range e.dirTimes {
+		dirs = append(dirs, dir)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+
+	for _, dir := range dirs {
+		if modified := e.dirTimes[dir]; !modified.IsZero() {
+			os.Chtimes(dir, modified, modified)
+		}
+	}
+
+	return nil
+}
+
+// maxSymlinkHops bounds how many links resolvesInside follows, so that link
+// loops are rejected.
+const maxSymlinkHops = 255
+
+// resolvesInside reports whether rel, relative to outputDir, stays inside
+// outputDir when every component is followed through the queued links and
+// any symlinks that already exist in outputDir.
+func (e *extraction) resolvesInside(links map[string]string, rel string) bool {
+	parts := strings.Split(rel, string(filepath.Separator))
+	resolved := ""
+	hops := 0
+
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
+
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if resolved == "" {
+				return false
+			}
+			if resolved = filepath.Dir(resolved); resolved == "." {
+				resolved = ""
+			}
+			continue
+		}
+
+		next := filepath.Join(resolved, part)
+		target, ok := links[next]
+		if !ok {
+			if info, err := os.Lstat(filepath.Join(e.outputDir, next)); err == nil && info.Mode()&os.ModeSymlink != 0 {
+				if target, err = os.Readlink(filepath.Join(e.outputDir, next)); err != nil {
+					return false
+				}
+				ok = true
+			}
+		}
+
+		if !ok {
+			resolved = next
+			continue
+		}
+
+		if hops++; hops > maxSymlinkHops || filepath.IsAbs(target) || filepath.VolumeName(target) != "" {
+			return false
+		}
+		// The target is relative to the directory of the link, which is
+		// where resolved already points
+		parts = append(strings.Split(target, string(filepath.Separator)), parts...)
+	}
+
+	return true
+}
+
+// safeJoin joins an archive entry name onto outputDir, returning an
+// UnsafePathError if the result is not inside outputDir.
+func safeJoin(outputDir string, name string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(cleaned) || filepath.VolumeName(cleaned) != "" || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", &UnsafePathError{Name: name}
+	}
+
+	return filepath.Join(outputDir, cleaned), nil
+}
+
+func relPath(outputDir string, path string) string {
+	rel, err := filepath.Rel(outputDir, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+// mkdirSafe creates dir and its parents below outputDir, failing if any of
+// the existing parents is a symlink, which could point outside of outputDir.
+func mkdirSafe(outputDir string, dir string, perm os.FileMode) error {
+	rel := relPath(outputDir, dir)
+	if rel == "." {
+		return nil
+	}
+
+	current := outputDir
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			if err := os.Mkdir(current, perm); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("Cannot extract into %s, it is a symlink", current)
+		} else if !info.IsDir() {
+			return fmt.Errorf("Cannot create directory %s, a file exists at its path", current)
+		}
+	}
+
+	return nil
+}
+
+func dirPerm(mode os.FileMode) os.FileMode {
+	// Always keep directories writable and listable by the owner
+	return mode.Perm() | 0700
+}
+
+// cleanDir removes the contents of dir, but not dir itself. It refuses to
+// clean the filesystem root, the working directory or one of its parents,
+// and Git repositories, which are unlikely to be meant as an output directory.
+func cleanDir(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	} else if abs == filepath.Dir(abs) {
+		return fmt.Errorf("Refusing to clean %s", abs)
+	}
+
+	if wd, err := os.Getwd(); err != nil {
+		return err
+	} else if rel, err := filepath.Rel(abs, wd); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("Refusing to clean %s, it contains the working directory", abs)
+	}
+
+	if _, err := os.Lstat(filepath.Join(abs, ".git")); err == nil {
+		return fmt.Errorf("Refusing to clean %s, it is a Git repository", abs)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
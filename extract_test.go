@@ -0,0 +1,390 @@
+package unitycloudbuild
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type tarEntry struct {
+	Name     string
+	Linkname string
+	Body     string
+	Type     byte
+}
+
+// writeTarGz creates a tar.gz archive in dir from entries and returns its path.
+func writeTarGz(t *testing.T, dir string, entries []tarEntry) string {
+	t.Helper()
+
+	filename := filepath.Join(dir, "archive.tar.gz")
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.Name, Linkname: entry.Linkname, Typeflag: entry.Type, Mode: 0644, Size: int64(len(entry.Body))}
+		if entry.Type == tar.TypeDir {
+			header.Mode = 0755
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(entry.Body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	} else if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+// extractTest extracts entries into an output directory below a fresh temp
+// dir, returning the temp dir, the output dir and the result of Extract.
+func extractTest(t *testing.T, entries []tarEntry) (string, string, error) {
+	t.Helper()
+
+	dir := t.TempDir()
+	outputDir := filepath.Join(dir, "out")
+	if err := os.Mkdir(outputDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	filename := writeTarGz(t, dir, entries)
+	return dir, outputDir, TarGzExtractor{}.Extract(context.Background(), filename, outputDir, ExtractOptions{})
+}
+
+func TestExtractRejectsUnsafeNames(t *testing.T) {
+	cases := map[string][]tarEntry{
+		"parent":        {{Name: "../escaped", Body: "x", Type: tar.TypeReg}},
+		"nested parent": {{Name: "a/../../escaped", Body: "x", Type: tar.TypeReg}},
+		"absolute":      {{Name: "/tmp/escaped", Body: "x", Type: tar.TypeReg}},
+		"absolute link": {{Name: "link", Linkname: "/etc", Type: tar.TypeSymlink}},
+		"parent link":   {{Name: "d/link", Linkname: "../..", Type: tar.TypeSymlink}},
+		"parent hardlink": {
+			{Name: "link", Linkname: "../escaped", Type: tar.TypeLink},
+		},
+	}
+
+	for name, entries := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir, _, err := extractTest(t, entries)
+
+			var unsafeErr *UnsafePathError
+			if !errors.As(err, &unsafeErr) {
+				t.Fatalf("Expected an UnsafePathError, got %v", err)
+			}
+			if _, err := os.Lstat(filepath.Join(dir, "escaped")); !os.IsNotExist(err) {
+				t.Errorf("A file was written outside of the output directory")
+			}
+		})
+	}
+}
+
+func TestExtractRejectsSymlinkChains(t *testing.T) {
+	cases := map[string][]tarEntry{
+		"chain": {
+			{Name: "d/l1", Linkname: "..", Type: tar.TypeSymlink},
+			{Name: "d/l2", Linkname: "l1/..", Type: tar.TypeSymlink},
+		},
+		"chain queued first": {
+			{Name: "d/l2", Linkname: "l1/..", Type: tar.TypeSymlink},
+			{Name: "d/l1", Linkname: "..", Type: tar.TypeSymlink},
+		},
+		"chain through directory link": {
+			{Name: "a/b/up", Linkname: "..", Type: tar.TypeSymlink},
+			{Name: "a/b/top", Linkname: "up/..", Type: tar.TypeSymlink},
+			{Name: "a/b/out", Linkname: "top/..", Type: tar.TypeSymlink},
+		},
+		"loop": {
+			{Name: "l1", Linkname: "l2", Type: tar.TypeSymlink},
+			{Name: "l2", Linkname: "l1", Type: tar.TypeSymlink},
+		},
+	}
+
+	for name, entries := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, outputDir, err := extractTest(t, entries)
+
+			var unsafeErr *UnsafePathError
+			if !errors.As(err, &unsafeErr) {
+				t.Fatalf("Expected an UnsafePathError, got %v", err)
+			}
+			for _, entry := range entries {
+				if _, err := os.Lstat(filepath.Join(outputDir, entry.Name)); !os.IsNotExist(err) {
+					t.Errorf("Symlink %s was created", entry.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractAllowsSymlinksInside(t *testing.T) {
+	_, outputDir, err := extractTest(t, []tarEntry{
+		{Name: "Game.app/Contents/Versions/A/Game", Body: "binary", Type: tar.TypeReg},
+		{Name: "Game.app/Contents/Versions/Current", Linkname: "A", Type: tar.TypeSymlink},
+		{Name: "Game.app/Contents/Game", Linkname: "Versions/Current/Game", Type: tar.TypeSymlink},
+		{Name: "d/l1", Linkname: "..", Type: tar.TypeSymlink},
+		{Name: "d/l2", Linkname: "l1/Game.app", Type: tar.TypeSymlink},
+		{Name: "dangling", Linkname: "missing/file", Type: tar.TypeSymlink},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(outputDir, "Game.app/Contents/Game"))
+	if err != nil {
+		t.Fatal(err)
+	} else if string(content) != "binary" {
+		t.Errorf("Expected the content through the symlink to be binary, got %s", content)
+	}
+
+	if _, err := os.Stat(filepath.Join(outputDir, "d/l2/Contents/Game")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExtractDoesNotWriteThroughSymlinkedParent(t *testing.T) {
+	dir := t.TempDir()
+	outputDir := filepath.Join(dir, "out")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{outputDir, outside} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Left over from a previous extraction into the same directory
+	if err := os.Symlink(outside, filepath.Join(outputDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string][]tarEntry{
+		"file":     {{Name: "link/escaped", Body: "x", Type: tar.TypeReg}},
+		"dir":      {{Name: "link/escaped/", Type: tar.TypeDir}},
+		"symlink":  {{Name: "other", Linkname: "link/escaped", Type: tar.TypeSymlink}},
+		"hardlink": {{Name: "escaped", Linkname: "link/secret", Type: tar.TypeLink}},
+	}
+
+	for name, entries := range cases {
+		t.Run(name, func(t *testing.T) {
+			filename := writeTarGz(t, dir, entries)
+			if err := (TarGzExtractor{}).Extract(context.Background(), filename, outputDir, ExtractOptions{}); err == nil {
+				t.Errorf("Expected extracting %s to fail", entries[0].Name)
+			}
+			if _, err := os.Lstat(filepath.Join(outside, "escaped")); !os.IsNotExist(err) {
+				t.Errorf("A file was written outside of the output directory")
+			}
+			if _, err := os.Lstat(filepath.Join(outputDir, "escaped")); !os.IsNotExist(err) {
+				t.Errorf("A file outside of the output directory was linked into it")
+			}
+		})
+	}
+}
+
+func TestCleanDirRefusesUnsafeDirs(t *testing.T) {
+	if err := cleanDir("."); err == nil {
+		t.Errorf("Expected cleaning the working directory to fail")
+	}
+	if err := cleanDir(".."); err == nil {
+		t.Errorf("Expected cleaning a parent of the working directory to fail")
+	}
+
+	repo := t.TempDir()
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := cleanDir(repo); err == nil {
+		t.Errorf("Expected cleaning a Git repository to fail")
+	}
+	if _, err := os.Stat(filepath.Join(repo, ".git")); err != nil {
+		t.Errorf("Expected .git to be kept: %v", err)
+	}
+
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "old.txt"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cleanDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected %s to be empty, got %d entries", dir, len(entries))
+	}
+}
+
+type zipEntry struct {
+	Name     string
+	Body     string
+	Mode     os.FileMode
+	Modified time.Time
+}
+
+// writeZip creates a zip archive in dir from entries and returns its path. A
+// symlink entry has its target as body.
+func writeZip(t *testing.T, dir string, entries []zipEntry) string {
+	t.Helper()
+
+	filename := filepath.Join(dir, "archive.zip")
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	zipWriter := zip.NewWriter(file)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.Name, Method: zip.Deflate, Modified: entry.Modified}
+		header.SetMode(entry.Mode)
+
+		w, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(entry.Body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func extractZipTest(t *testing.T, outputDir string, entries []zipEntry, options ExtractOptions) error {
+	t.Helper()
+	filename := writeZip(t, t.TempDir(), entries)
+	return ZipExtractor{}.Extract(context.Background(), filename, outputDir, options)
+}
+
+func TestExtractZipFramework(t *testing.T) {
+	modified := time.Date(2020, 5, 17, 12, 30, 0, 0, time.UTC)
+	outputDir := t.TempDir()
+
+	// The layout of a macOS framework, whose top level entries link through
+	// Versions/Current
+	err := extractZipTest(t, outputDir, []zipEntry{
+		{Name: "Game.app/Contents/Frameworks/Engine.framework/", Mode: os.ModeDir | 0755, Modified: modified},
+		{Name: "Game.app/Contents/Frameworks/Engine.framework/Versions/A/Engine", Body: "engine", Mode: 0755, Modified: modified},
+		{Name: "Game.app/Contents/Frameworks/Engine.framework/Versions/A/Resources/Info.plist", Body: "plist", Mode: 0644, Modified: modified},
+		{Name: "Game.app/Contents/Frameworks/Engine.framework/Versions/Current", Body: "A", Mode: os.ModeSymlink | 0755},
+		{Name: "Game.app/Contents/Frameworks/Engine.framework/Engine", Body: "Versions/Current/Engine", Mode: os.ModeSymlink | 0755},
+		{Name: "Game.app/Contents/Frameworks/Engine.framework/Resources", Body: "Versions/Current/Resources", Mode: os.ModeSymlink | 0755},
+	}, ExtractOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	framework := filepath.Join(outputDir, "Game.app/Contents/Frameworks/Engine.framework")
+
+	if content, err := ioutil.ReadFile(filepath.Join(framework, "Engine")); err != nil {
+		t.Fatal(err)
+	} else if string(content) != "engine" {
+		t.Errorf("Expected engine through the symlink chain, got %s", content)
+	}
+	if _, err := os.Stat(filepath.Join(framework, "Resources/Info.plist")); err != nil {
+		t.Error(err)
+	}
+	if target, err := os.Readlink(filepath.Join(framework, "Versions/Current")); err != nil || target != "A" {
+		t.Errorf("Expected Versions/Current to link to A, got %q: %v", target, err)
+	}
+
+	info, err := os.Stat(filepath.Join(framework, "Versions/A/Engine"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("Expected the executable bits to be kept, got %v", info.Mode())
+	}
+	if !info.ModTime().Equal(modified) {
+		t.Errorf("Expected the file to be modified at %v, got %v", modified, info.ModTime())
+	}
+
+	if info, err := os.Stat(framework); err != nil {
+		t.Fatal(err)
+	} else if !info.ModTime().Equal(modified) {
+		t.Errorf("Expected the directory to be modified at %v, got %v", modified, info.ModTime())
+	}
+
+	if info, err := os.Stat(filepath.Join(framework, "Versions/A/Resources/Info.plist")); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0644 {
+		t.Errorf("Expected the plist to not be executable, got %v", info.Mode())
+	}
+}
+
+func TestExtractZipRejectsSymlinkChains(t *testing.T) {
+	dir := t.TempDir()
+	outputDir := filepath.Join(dir, "out")
+	if err := os.Mkdir(outputDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	err := extractZipTest(t, outputDir, []zipEntry{
+		{Name: "Game.app/Contents/up", Body: "..", Mode: os.ModeSymlink | 0755},
+		{Name: "Game.app/Contents/top", Body: "up/..", Mode: os.ModeSymlink | 0755},
+		{Name: "Game.app/Contents/escaped", Body: "top/..", Mode: os.ModeSymlink | 0755},
+	}, ExtractOptions{})
+
+	var unsafeErr *UnsafePathError
+	if !errors.As(err, &unsafeErr) {
+		t.Fatalf("Expected an UnsafePathError, got %v", err)
+	} else if unsafeErr.Name != "Game.app/Contents/escaped" {
+		t.Errorf("Expected Game.app/Contents/escaped to be rejected, got %s", unsafeErr.Name)
+	}
+	if _, err := os.Lstat(filepath.Join(outputDir, "Game.app/Contents/escaped")); !os.IsNotExist(err) {
+		t.Errorf("Expected the escaping symlink to not be created")
+	}
+}
+
+func TestExtractZipClean(t *testing.T) {
+	outputDir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(outputDir, "old.txt"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []zipEntry{{Name: "new.txt", Body: "new", Mode: 0644}}
+
+	if err := extractZipTest(t, outputDir, entries, ExtractOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "old.txt")); err != nil {
+		t.Errorf("Expected old.txt to be kept without Clean: %v", err)
+	}
+
+	var written []string
+	if err := extractZipTest(t, outputDir, entries, ExtractOptions{Clean: true, OnFile: func(path string) {
+		written = append(written, path)
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "old.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected old.txt to be removed with Clean")
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "new.txt")); err != nil {
+		t.Error(err)
+	}
+	if len(written) != 1 || written[0] != filepath.Join(outputDir, "new.txt") {
+		t.Errorf("Expected OnFile to be called with new.txt, got %v", written)
+	}
+}
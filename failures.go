@@ -0,0 +1,173 @@
+package unitycloudbuild
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type FailureKind string
+
+const (
+	FailureKind_Compiler  FailureKind = "compiler"
+	FailureKind_Exception FailureKind = "exception"
+	FailureKind_IL2CPP    FailureKind = "il2cpp"
+	FailureKind_Gradle    FailureKind = "gradle"
+	FailureKind_Xcode     FailureKind = "xcode"
+	FailureKind_Import    FailureKind = "import"
+)
+
+// BuildFailure is a single error found in a build log.
+type BuildFailure struct {
+	Kind    FailureKind `json:"kind"`
+	File    string      `json:"file,omitempty"`
+	Line    int         `json:"line,omitempty"`
+	Code    string      `json:"code,omitempty"`
+	Message string      `json:"message"`
+}
+
+func (f BuildFailure) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] ", f.Kind)
+	if len(f.File) > 0 {
+		b.WriteString(f.File)
+		if f.Line > 0 {
+			fmt.Fprintf(&b, "(%d)", f.Line)
+		}
+		b.WriteString(": ")
+	}
+	if len(f.Code) > 0 {
+		fmt.Fprintf(&b, "%s: ", f.Code)
+	}
+	b.WriteString(f.Message)
+	return b.String()
+}
+
+var (
+	// Assets/Scripts/Player.cs(12,34): error CS0246: The type or namespace name 'Foo' could not be found
+	csharpErrorRegex = regexp.MustCompile(`([^\s:]+\.cs)\((\d+),\d+\): error (CS\d+): (.+)`)
+
+	// /path/to/File.mm:12:5: error: use of undeclared identifier 'foo'
+	clangErrorRegex = regexp.MustCompile(`([^\s:]+\.(?:m|mm|h|c|cpp|swift)):(\d+):\d+: (?:fatal )?error: (.+)`)
+
+	// NullReferenceException: Object reference not set to an instance of an object
+	exceptionRegex = regexp.MustCompile(`\b((?:[A-Za-z_][\w]*\.)*[A-Za-z_]\w*Exception): (.+)`)
+
+	il2cppRegex        = regexp.MustCompile(`(?i)\bil2cpp\b.*\b(?:error|failed)\b.*`)
+	xcodeFailedRegex   = regexp.MustCompile(`\*\* (?:ARCHIVE|BUILD|EXPORT) FAILED \*\*`)
+	gradleTaskRegex    = regexp.MustCompile(`> Task (\S+) FAILED`)
+	gradleWrongRegex   = regexp.MustCompile(`\* What went wrong:`)
+	importFailureRegex = regexp.MustCompile(`(?i)(?:failed to import|error while importing|import error)\b.*`)
+	scriptErrorsRegex  = regexp.MustCompile(`Scripts have compiler errors|scripts had compiler errors`)
+)
+
+const maxLogLineLength = 1024 * 1024
+
+// AnalyzeLog scans a build log for compiler errors, exceptions and platform
+// build failures. Duplicate failures are only reported once.
+func AnalyzeLog(buildLog []byte) []BuildFailure {
+	var failures []BuildFailure
+	seen := make(map[BuildFailure]bool)
+
+	add := func(f BuildFailure) {
+		f.Message = strings.TrimSpace(f.Message)
+		if !seen[f] {
+			seen[f] = true
+			failures = append(failures, f)
+		}
+	}
+
+	gradleWentWrong := false
+
+	for rest := buildLog; len(rest) > 0; {
+		var lineBytes []byte
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			lineBytes, rest = rest[:i], rest[i+1:]
+		} else {
+			lineBytes, rest = rest, nil
+		}
+
+		// Only the start of over-long lines is matched, they are usually
+		// dumps of data rather than error messages
+		if len(lineBytes) > maxLogLineLength {
+			lineBytes = lineBytes[:maxLogLineLength]
+		}
+		line := string(bytes.TrimSuffix(lineBytes, []byte("\r")))
+
+		// The line after "* What went wrong:" describes the Gradle failure
+		if gradleWentWrong {
+			if trimmed := strings.TrimSpace(line); len(trimmed) > 0 {
+				add(BuildFailure{Kind: FailureKind_Gradle, Message: trimmed})
+				gradleWentWrong = false
+			}
+			continue
+		}
+
+		if m := csharpErrorRegex.FindStringSubmatch(line); m != nil {
+			lineNumber, _ := strconv.Atoi(m[2])
+			add(BuildFailure{Kind: FailureKind_Compiler, File: m[1], Line: lineNumber, Code: m[3], Message: m[4]})
+		} else if m := clangErrorRegex.FindStringSubmatch(line); m != nil {
+			lineNumber, _ := strconv.Atoi(m[2])
+			add(BuildFailure{Kind: FailureKind_Xcode, File: m[1], Line: lineNumber, Message: m[3]})
+		} else if m := xcodeFailedRegex.FindString(line); len(m) > 0 {
+			add(BuildFailure{Kind: FailureKind_Xcode, Message: strings.Trim(m, "* ")})
+		} else if gradleWrongRegex.MatchString(line) {
+			gradleWentWrong = true
+		} else if m := gradleTaskRegex.FindStringSubmatch(line); m != nil {
+			add(BuildFailure{Kind: FailureKind_Gradle, Code: m[1], Message: "Task failed"})
+		} else if m := il2cppRegex.FindString(line); len(m) > 0 {
+			add(BuildFailure{Kind: FailureKind_IL2CPP, Message: m})
+		} else if m := exceptionRegex.FindStringSubmatch(line); m != nil {
+			add(BuildFailure{Kind: FailureKind_Exception, Code: m[1], Message: m[2]})
+		} else if m := importFailureRegex.FindString(line); len(m) > 0 {
+			add(BuildFailure{Kind: FailureKind_Import, Message: m})
+		} else if m := scriptErrorsRegex.FindString(line); len(m) > 0 {
+			add(BuildFailure{Kind: FailureKind_Compiler, Message: m})
+		}
+	}
+
+	return failures
+}
+
+// Builds_Failures downloads the full log of a build and returns the failures
+// found in it.
+func (c *Client) Builds_Failures(ctx context.Context, buildTargetId string, buildNumber int64) ([]BuildFailure, error) {
+	buildLog, err := c.Builds_Log(ctx, buildTargetId, buildNumber, 0, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return AnalyzeLog(buildLog), nil
+}
+
+const maxFailureSummary = 10
+
+// printFailureSummary outputs the first few failures found in the log of a
+// failed build. Errors fetching the log are only logged, as the build status
+// has already been reported.
+func (c *Client) printFailureSummary(ctx context.Context, build *Build) {
+	failures, err := c.Builds_Failures(ctx, build.TargetId, int64(build.Number))
+	if err != nil {
+		if c.Context.Verbose {
+			log.Printf("Could not analyze log for %s #%d: %v", build.TargetId, build.Number, err)
+		}
+		return
+	}
+
+	if len(failures) == 0 {
+		fmt.Printf("  No errors found in log.\n")
+		return
+	}
+
+	for i, failure := range failures {
+		if i == maxFailureSummary {
+			fmt.Printf("  (%d more)\n", len(failures)-maxFailureSummary)
+			break
+		}
+		fmt.Printf("  %s\n", failure)
+	}
+}
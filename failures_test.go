@@ -0,0 +1,112 @@
+package unitycloudbuild
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeLogLongLine(t *testing.T) {
+	buildLog := "Assets/A.cs(1,2): error CS0001: First\r\n" +
+		strings.Repeat("x", 2*maxLogLineLength) + "\n" +
+		"Assets/B.cs(3,4): error CS0002: Second\n"
+
+	failures := AnalyzeLog([]byte(buildLog))
+
+	expected := []BuildFailure{
+		{Kind: FailureKind_Compiler, File: "Assets/A.cs", Line: 1, Code: "CS0001", Message: "First"},
+		{Kind: FailureKind_Compiler, File: "Assets/B.cs", Line: 3, Code: "CS0002", Message: "Second"},
+	}
+	if len(failures) != len(expected) {
+		t.Fatalf("Expected %d failures, got %v", len(expected), failures)
+	}
+	for i := range expected {
+		if failures[i] != expected[i] {
+			t.Errorf("Failure %d: expected %v, got %v", i, expected[i], failures[i])
+		}
+	}
+}
+
+func TestAnalyzeLog(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Log      string
+		Expected []BuildFailure
+	}{
+		{"csharp compiler", `
+[Unity] -----CompilerOutput:-stdout--exitcode: 1--compilationhadfailure: True--outfile: Temp/Assembly-CSharp.dll
+[Unity] Assets/Scripts/Player/PlayerController.cs(42,17): error CS0246: The type or namespace name 'Rigidbody3D' could not be found (are you missing a using directive or an assembly reference?)
+[Unity] Assets/Scripts/Player/PlayerController.cs(42,17): error CS0246: The type or namespace name 'Rigidbody3D' could not be found (are you missing a using directive or an assembly reference?)
+[Unity] Assets/Scripts/UI/Menu.cs(7,1): warning CS0618: 'WWW' is obsolete
+[Unity] -----EndCompilerOutput---------------
+[Unity] Scripts have compiler errors.
+`, []BuildFailure{
+			{Kind: FailureKind_Compiler, File: "Assets/Scripts/Player/PlayerController.cs", Line: 42, Code: "CS0246", Message: "The type or namespace name 'Rigidbody3D' could not be found (are you missing a using directive or an assembly reference?)"},
+			{Kind: FailureKind_Compiler, Message: "Scripts have compiler errors"},
+		}},
+		{"clang and xcode", `
+[xcode] CompileC /BUILD_PATH/Build/Intermediates.noindex/ArchiveIntermediates/Unity-iPhone/UnityAppController.o Classes/UnityAppController.mm normal arm64 objective-c++
+[xcode] /BUILD_PATH/org.project.ios/temp/Classes/UnityAppController.mm:123:5: error: use of undeclared identifier 'UnityInitTrampoline'
+[xcode] 1 error generated.
+[xcode] ** ARCHIVE FAILED **
+`, []BuildFailure{
+			{Kind: FailureKind_Xcode, File: "/BUILD_PATH/org.project.ios/temp/Classes/UnityAppController.mm", Line: 123, Message: "use of undeclared identifier 'UnityInitTrampoline'"},
+			{Kind: FailureKind_Xcode, Message: "ARCHIVE FAILED"},
+		}},
+		{"gradle", `
+[Unity] CommandInvokationFailure: Gradle build failed.
+/BUILD_PATH/.unity/OpenJDK/bin/java -classpath "/BUILD_PATH/.unity/Gradle/lib/gradle-launcher-6.1.1.jar" org.gradle.launcher.GradleMain "-Dorg.gradle.jvmargs=-Xmx4096m" "assembleRelease"
+
+stderr[
+> Task :launcher:checkReleaseDuplicateClasses FAILED
+
+FAILURE: Build failed with an exception.
+
+* What went wrong:
+Execution failed for task ':launcher:checkReleaseDuplicateClasses'.
+> A failure occurred while executing com.android.build.gradle.internal.tasks.CheckDuplicatesRunnable
+`, []BuildFailure{
+			{Kind: FailureKind_Gradle, Code: ":launcher:checkReleaseDuplicateClasses", Message: "Task failed"},
+			{Kind: FailureKind_Gradle, Message: "Execution failed for task ':launcher:checkReleaseDuplicateClasses'."},
+		}},
+		{"il2cpp", `
+[Unity] Building Library/Bee/artifacts/WebGL/il2cpp/build/Assembly-CSharp.cpp
+[Unity] IL2CPP error for method 'System.Void Game.Save::Write(System.IO.Stream)' in assembly '/BUILD_PATH/Temp/StagingArea/Data/Managed/Assembly-CSharp.dll'
+[Unity] UnityEditor.Build.BuildFailedException: Incremental Player build failed!
+`, []BuildFailure{
+			{Kind: FailureKind_IL2CPP, Message: "IL2CPP error for method 'System.Void Game.Save::Write(System.IO.Stream)' in assembly '/BUILD_PATH/Temp/StagingArea/Data/Managed/Assembly-CSharp.dll'"},
+			{Kind: FailureKind_Exception, Code: "UnityEditor.Build.BuildFailedException", Message: "Incremental Player build failed!"},
+		}},
+		{"exception", `
+[Unity] NullReferenceException: Object reference not set to an instance of an object
+[Unity]   at BuildScript.PreExport (UnityEngine.CloudBuild.BuildManifestObject manifest) [0x00012] in /BUILD_PATH/Assets/Editor/BuildScript.cs:27
+[Unity]   at UnityEditor.CloudBuild.Builder.Build () [0x00000] in <00000000000000000000000000000000>:0
+`, []BuildFailure{
+			{Kind: FailureKind_Exception, Code: "NullReferenceException", Message: "Object reference not set to an instance of an object"},
+		}},
+		{"import", `
+[Unity] Start importing Assets/Models/Tree.fbx using Guid(8c1f0e3b2a9d4e5f8a7b6c5d4e3f2a1b) Importer(-1,00000000000000000000000000000000)
+[Unity] Failed to import package with error: Couldn't decompress package
+`, []BuildFailure{
+			{Kind: FailureKind_Import, Message: "Failed to import package with error: Couldn't decompress package"},
+		}},
+		{"success", `
+[Unity] Build Finished, Result: Success.
+[Unity] Exiting batchmode successfully now!
+`, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			failures := AnalyzeLog([]byte(tc.Log))
+
+			if len(failures) != len(tc.Expected) {
+				t.Fatalf("Expected %d failures, got %v", len(tc.Expected), failures)
+			}
+			for i := range tc.Expected {
+				if failures[i] != tc.Expected[i] {
+					t.Errorf("Failure %d: expected %v, got %v", i, tc.Expected[i], failures[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,584 @@
+package unitycloudbuild
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+func (c *Client) Git_BuildsMatchHead(ctx context.Context, repoPath string, buildTargetId string, buildNumber int64, all bool) (bool, error) {
+	repo, err := openGitRepo(repoPath)
+	if err != nil {
+		return false, err
+	}
+
+	// The working tree is only checked for the warning
+	commit, err := c.gitHead(repo, c.gitWarnings())
+	if err != nil {
+		return false, err
+	}
+
+	if c.Context.OutputFormat == OutputFormat_Human {
+		fmt.Printf("HEAD: %s\n", commit.Revision)
+	}
+
+	if commit.Dirty {
+		log.Printf("Warning: the working tree has uncommitted changes, builds cannot include them")
+	}
+
+	var builds []*Build
+	var missingBuilds []string
+
+	if all {
+		latestBuilds, err := c.Builds_Latest(ctx, true, true)
+		if err != nil {
+			return false, err
+		}
+		for targetName, build := range latestBuilds {
+			if build == nil {
+				missingBuilds = append(missingBuilds, targetName)
+				continue
+			}
+			builds = append(builds, build)
+		}
+	} else if buildNumber > 0 {
+		build, err := c.Builds_Status(ctx, buildTargetId, buildNumber)
+		if err != nil {
+			return false, err
+		}
+		builds = append(builds, build)
+	} else {
+		latestBuilds, err := c.Builds_Latest(ctx, true, true)
+		if err != nil {
+			return false, err
+		} else if build, ok := latestBuilds[buildTargetId]; ok {
+			if build == nil {
+				missingBuilds = append(missingBuilds, buildTargetId)
+			} else {
+				builds = append(builds, build)
+			}
+		}
+	}
+
+	// The branch each target builds from, for the warnings
+	var targetBranches map[string]string
+	if c.gitWarnings() && len(builds) > 0 {
+		targetBranches = c.targetBranches(ctx)
+	}
+
+	// HEAD compared to the remote tracking branch of each branch
+	branchStatus := make(map[string]*GitBranchStatus)
+	compareBranch := func(branch string) *GitBranchStatus {
+		if status, ok := branchStatus[branch]; ok {
+			return status
+		}
+
+		status, err := gitCompareBranch(repo, commit.Revision, branch)
+		if err != nil && c.Context.Verbose {
+			log.Printf("Could not compare HEAD to branch %s: %v", branch, err)
+		}
+		branchStatus[branch] = status
+		return status
+	}
+
+	allMatch := true
+
+	for _, targetName := range missingBuilds {
+		if c.Context.OutputFormat == OutputFormat_Human {
+			fmt.Printf("Target %s does not have a successful build.\n", targetName)
+		}
+
+		allMatch = false
+	}
+
+	for _, build := range builds {
+		if build.Status != "success" {
+			if c.Context.OutputFormat == OutputFormat_Human {
+				fmt.Printf("Build %s #%d is not a successful build\n", build.TargetId, build.Number)
+			}
+			allMatch = false
+			continue
+		}
+
+		// The branch the build was made from is only known from the target
+		// settings, or what the build reports if they are missing
+		branch := targetBranches[build.TargetId]
+		if len(branch) == 0 {
+			branch = build.ScmBranch
+		}
+
+		if c.gitWarnings() && len(commit.Branch) > 0 && len(branch) > 0 && branch != commit.Branch {
+			log.Printf("Warning: target %s builds branch %s, HEAD is on branch %s", build.TargetId, branch, commit.Branch)
+		}
+
+		if build.LastBuiltRevision != commit.Revision {
+			if c.Context.OutputFormat == OutputFormat_Human {
+				fmt.Printf("Build %s #%d is revision %s, head is %s\n", build.TargetId, build.Number, shortRevision(build.LastBuiltRevision), shortRevision(commit.Revision))
+			}
+
+			if c.gitWarnings() && len(branch) > 0 {
+				if status := compareBranch(branch); status != nil && (status.Ahead > 0 || status.Behind > 0) {
+					log.Printf("HEAD is %d commits ahead and %d behind %s, which target %s builds", status.Ahead, status.Behind, status.Remote, build.TargetId)
+				}
+			}
+
+			allMatch = false
+			continue
+		}
+
+		if c.Context.OutputFormat == OutputFormat_Human {
+			fmt.Printf("Build %s #%d matches HEAD.\n", build.TargetId, build.Number)
+		}
+	}
+
+	return allMatch, nil
+}
+
+func openGitRepo(repoPath string) (*git.Repository, error) {
+	if repoPath == "" {
+		repoPath = "."
+	}
+
+	repo, err := git.PlainOpenWithOptions(repoPath, &git.PlainOpenOptions{
+		DetectDotGit: true,
+	})
+
+	if err != nil {
+		return nil, &GitError{Op: "open", Err: err}
+	}
+
+	return repo, nil
+}
+
+// Git_Head returns the commit checked out in the repository at repoPath, or
+// a parent directory of it.
+func (c *Client) Git_Head(repoPath string) (*GitCommit, error) {
+	repo, err := openGitRepo(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.gitHead(repo, true)
+}
+
+// Git_HeadForTarget is like Git_Head, but also compares HEAD to the remote
+// tracking branch of the branch the target builds from, see
+// GitCommit.TargetBranch.
+func (c *Client) Git_HeadForTarget(ctx context.Context, repoPath string, buildTargetId string) (*GitCommit, error) {
+	repo, err := openGitRepo(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := c.gitHead(repo, true)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := c.findTarget(ctx, buildTargetId)
+	if err != nil {
+		return nil, err
+	}
+
+	if target.Settings == nil || len(target.Settings.Scm.Branch) == 0 {
+		return nil, fmt.Errorf("Target %s has no SCM branch", target.Id)
+	}
+
+	if commit.TargetBranch, err = gitCompareBranch(repo, commit.Revision, target.Settings.Scm.Branch); err != nil {
+		return nil, err
+	}
+
+	return commit, nil
+}
+
+// targetBranches returns the SCM branch of each target. Errors are only
+// logged, as the branches are just used for warnings.
+func (c *Client) targetBranches(ctx context.Context) map[string]string {
+	branches := make(map[string]string)
+
+	targets, err := c.Targets_List(ctx)
+	if err != nil {
+		if c.Context.Verbose {
+			log.Printf("Could not get the branches of targets: %v", err)
+		}
+		return branches
+	}
+
+	for _, target := range targets {
+		if target.Settings != nil {
+			branches[target.Id] = target.Settings.Scm.Branch
+		}
+	}
+
+	return branches
+}
+
+func (c *Client) findTarget(ctx context.Context, buildTargetId string) (*BuildTarget, error) {
+	targets, err := c.Targets_List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range targets {
+		if targets[i].Id == buildTargetId {
+			return &targets[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("Cannot find target %s", buildTargetId)
+}
+
+// gitHead returns the commit checked out in repo. Checking whether the
+// working tree is dirty reads every tracked file, so it is only done if
+// checkDirty is set. If the check fails, Dirty is left false.
+func (c *Client) gitHead(repo *git.Repository, checkDirty bool) (*GitCommit, error) {
+	head, err := repo.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, &GitError{Op: "head", Err: fmt.Errorf("repository has no commits yet")}
+	} else if err != nil {
+		return nil, &GitError{Op: "head", Err: err}
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, &GitError{Op: "commit", Err: err}
+	}
+
+	info := &GitCommit{
+		Revision: commit.Hash.String(),
+		Message:  commit.Message,
+		Author:   fmt.Sprintf("%s <%s>", commit.Author.Name, commit.Author.Email),
+		Time:     commit.Author.When,
+	}
+
+	// A detached HEAD is not on a branch
+	if head.Name().IsBranch() {
+		info.Branch = head.Name().Short()
+	}
+
+	if info.Tags, err = gitTagsAt(repo, head.Hash()); err != nil {
+		return nil, err
+	}
+
+	if checkDirty {
+		if info.Dirty, err = gitIsDirty(repo); err != nil && c.Context.Verbose {
+			log.Printf("Could not check the working tree for changes: %v", err)
+		}
+	}
+
+	return info, nil
+}
+
+// gitTagsAt returns the names of the lightweight and annotated tags pointing
+// at hash.
+func gitTagsAt(repo *git.Repository, hash plumbing.Hash) ([]string, error) {
+	tags, err := repo.Tags()
+	if err != nil {
+		return nil, &GitError{Op: "tags", Err: err}
+	}
+
+	var names []string
+	err = tags.ForEach(func(ref *plumbing.Reference) error {
+		target := ref.Hash()
+		if tag, err := repo.TagObject(target); err == nil {
+			target = tag.Target
+		}
+
+		if target == hash {
+			names = append(names, ref.Name().Short())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, &GitError{Op: "tags", Err: err}
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// gitIsDirty returns true if tracked files have changes that are not
+// committed. Untracked files are ignored, like git describe --dirty does.
+func gitIsDirty(repo *git.Repository) (bool, error) {
+	worktree, err := repo.Worktree()
+	if err == git.ErrIsBareRepository {
+		return false, nil
+	} else if err != nil {
+		return false, &GitError{Op: "worktree", Err: err}
+	}
+
+	status, err := worktree.Status()
+	if err != nil {
+		return false, &GitError{Op: "status", Err: err}
+	}
+
+	for _, file := range status {
+		if file.Worktree == git.Untracked {
+			continue
+		}
+		if file.Staging != git.Unmodified || file.Worktree != git.Unmodified {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// gitRemoteBranches returns the remote tracking branches of branch, the one
+// of origin first.
+func gitRemoteBranches(repo *git.Repository, branch string) ([]*plumbing.Reference, error) {
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return nil, &GitError{Op: "remotes", Err: err}
+	}
+
+	sort.SliceStable(remotes, func(i, j int) bool {
+		return remotes[i].Config().Name == "origin" && remotes[j].Config().Name != "origin"
+	})
+
+	var refs []*plumbing.Reference
+	for _, remote := range remotes {
+		ref, err := repo.Reference(plumbing.NewRemoteReferenceName(remote.Config().Name, branch), true)
+		if err == plumbing.ErrReferenceNotFound {
+			continue
+		} else if err != nil {
+			return nil, &GitError{Op: "reference", Err: err}
+		}
+		refs = append(refs, ref)
+	}
+
+	return refs, nil
+}
+
+// gitCompareBranch counts the commits on revision and not on the remote
+// tracking branch of branch, and the other way around.
+func gitCompareBranch(repo *git.Repository, revision string, branch string) (*GitBranchStatus, error) {
+	refs, err := gitRemoteBranches(repo, branch)
+	if err != nil {
+		return nil, err
+	} else if len(refs) == 0 {
+		return nil, &GitError{Op: "reference", Err: fmt.Errorf("no remote tracking branch for %s, try git fetch", branch)}
+	}
+
+	status := &GitBranchStatus{Branch: branch, Remote: refs[0].Name().Short()}
+	if status.Ahead, status.Behind, err = gitAheadBehind(repo, plumbing.NewHash(revision), refs[0].Hash()); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+const (
+	gitFromLocal  = 1
+	gitFromRemote = 2
+)
+
+// gitAheadBehind counts the commits reachable from local and not from remote,
+// and the other way around. Like git rev-list --left-right --count, both
+// histories are walked newest first and only until they meet, instead of to
+// their root.
+func gitAheadBehind(repo *git.Repository, local plumbing.Hash, remote plumbing.Hash) (int, int, error) {
+	flags := make(map[plumbing.Hash]int)
+	queued := make(map[plumbing.Hash]bool)
+	var popped []plumbing.Hash
+	queue := &gitCommitQueue{}
+
+	visit := func(hash plumbing.Hash, flag int) error {
+		if flags[hash]|flag == flags[hash] {
+			return nil
+		}
+		flags[hash] |= flag
+
+		// A queued commit passes on its flags once it is popped, one that was
+		// popped already is queued again to pass on the new one
+		if queued[hash] {
+			return nil
+		}
+		commit, err := repo.CommitObject(hash)
+		if err != nil {
+			return &GitError{Op: "commit", Err: err}
+		}
+		heap.Push(queue, commit)
+		queued[hash] = true
+		return nil
+	}
+
+	if err := visit(local, gitFromLocal); err != nil {
+		return 0, 0, err
+	} else if err := visit(remote, gitFromRemote); err != nil {
+		return 0, 0, err
+	}
+
+	// Once every queued commit is reachable from both, so are their ancestors
+	for queue.hasUnshared(flags) {
+		commit := heap.Pop(queue).(*object.Commit)
+		queued[commit.Hash] = false
+		popped = append(popped, commit.Hash)
+
+		for _, parent := range commit.ParentHashes {
+			if err := visit(parent, flags[commit.Hash]); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	ahead, behind := 0, 0
+	counted := make(map[plumbing.Hash]bool, len(popped))
+	for _, hash := range popped {
+		if counted[hash] {
+			continue
+		}
+		counted[hash] = true
+
+		switch flags[hash] {
+		case gitFromLocal:
+			ahead++
+		case gitFromRemote:
+			behind++
+		}
+	}
+
+	return ahead, behind, nil
+}
+
+// gitCommitQueue is a heap of commits, the most recently committed first.
+type gitCommitQueue []*object.Commit
+
+func (q gitCommitQueue) Len() int { return len(q) }
+func (q gitCommitQueue) Less(i, j int) bool {
+	return q[i].Committer.When.After(q[j].Committer.When)
+}
+func (q gitCommitQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *gitCommitQueue) Push(x interface{}) { *q = append(*q, x.(*object.Commit)) }
+func (q *gitCommitQueue) Pop() interface{} {
+	old := *q
+	commit := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return commit
+}
+
+func (q gitCommitQueue) hasUnshared(flags map[plumbing.Hash]int) bool {
+	for _, commit := range q {
+		if flags[commit.Hash] != gitFromLocal|gitFromRemote {
+			return true
+		}
+	}
+	return false
+}
+
+// gitWarnings returns true if warnings about the local repository are logged,
+// which would otherwise be mixed into machine readable output.
+func (c *Client) gitWarnings() bool {
+	return c.Context.OutputFormat == OutputFormat_Human || c.Context.Verbose
+}
+
+func shortRevision(revision string) string {
+	if len(revision) > 8 {
+		return revision[:8]
+	}
+	return revision
+}
+
+// Git_BuildHead starts builds of the local HEAD revision for a target, or all
+// enabled targets if all is set, and waits for them like Builds_Run. The
+// revision must have been pushed to the branch each target builds from, which
+// is checked against the remote tracking branches of the local repository, so
+// they need to be up to date.
+func (c *Client) Git_BuildHead(ctx context.Context, repoPath string, buildTargetId string, all bool, start StartOptions, options WaitOptions) ([]*Build, error) {
+	repo, err := openGitRepo(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// The working tree is only checked for the warning
+	commit, err := c.gitHead(repo, c.gitWarnings())
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Context.OutputFormat == OutputFormat_Human {
+		fmt.Printf("HEAD: %s\n", commit.Revision)
+	}
+
+	if commit.Dirty {
+		log.Printf("Warning: the working tree has uncommitted changes, they will not be built")
+	}
+
+	allTargets, err := c.Targets_List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []BuildTarget
+	for _, target := range allTargets {
+		if (all && target.Enabled) || target.Id == buildTargetId {
+			targets = append(targets, target)
+		}
+	}
+
+	if len(targets) == 0 {
+		if all {
+			return nil, fmt.Errorf("No enabled targets")
+		}
+		return nil, fmt.Errorf("Cannot find target %s", buildTargetId)
+	}
+
+	// Several targets usually build the same branch
+	pushed := make(map[string]bool)
+
+	for _, target := range targets {
+		if target.Settings == nil || len(target.Settings.Scm.Branch) == 0 {
+			return nil, fmt.Errorf("Target %s has no SCM branch", target.Id)
+		}
+		branch := target.Settings.Scm.Branch
+
+		if _, ok := pushed[branch]; !ok {
+			if pushed[branch], err = gitCommitOnRemoteBranch(repo, commit.Revision, branch); err != nil {
+				return nil, err
+			}
+		}
+
+		if !pushed[branch] {
+			return nil, &NotPushedError{Revision: commit.Revision, Branch: branch, TargetId: target.Id}
+		}
+	}
+
+	start.Commit = commit.Revision
+
+	return c.Builds_Run(ctx, buildTargetId, all, start, options)
+}
+
+// gitCommitOnRemoteBranch returns true if revision is on branch of any
+// remote, according to the remote tracking branches.
+func gitCommitOnRemoteBranch(repo *git.Repository, revision string, branch string) (bool, error) {
+	commit, err := repo.CommitObject(plumbing.NewHash(revision))
+	if err != nil {
+		return false, &GitError{Op: "commit", Err: err}
+	}
+
+	refs, err := gitRemoteBranches(repo, branch)
+	if err != nil {
+		return false, err
+	}
+
+	for _, ref := range refs {
+		remoteCommit, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			return false, &GitError{Op: "commit", Err: err}
+		}
+
+		if ok, err := commit.IsAncestor(remoteCommit); err != nil {
+			return false, &GitError{Op: "log", Err: err}
+		} else if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
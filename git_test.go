@@ -0,0 +1,169 @@
+package unitycloudbuild
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// testCommit stores a commit made minutes after an arbitrary start time.
+func testCommit(t *testing.T, repo *git.Repository, minutes int, parents ...plumbing.Hash) plumbing.Hash {
+	t.Helper()
+
+	signature := object.Signature{Name: "Test", Email: "test@example.com", When: time.Date(2020, 1, 1, 0, minutes, 0, 0, time.UTC)}
+	commit := &object.Commit{
+		Author:       signature,
+		Committer:    signature,
+		Message:      fmt.Sprintf("Commit at %d", minutes),
+		ParentHashes: parents,
+	}
+
+	obj := repo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestGitAheadBehind(t *testing.T) {
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A long shared history, which should not need to be walked
+	fork := testCommit(t, repo, 0)
+	for i := 1; i <= 100; i++ {
+		fork = testCommit(t, repo, i, fork)
+	}
+
+	// The local branch merged the remote branch once, after which the
+	// remote branch moved on
+	merged := testCommit(t, repo, 200, fork)
+	local := testCommit(t, repo, 300, fork)
+	local = testCommit(t, repo, 400, local, merged)
+	local = testCommit(t, repo, 700, local)
+	remote := testCommit(t, repo, 500, merged)
+	remote = testCommit(t, repo, 600, remote)
+
+	cases := []struct {
+		Name          string
+		Local, Remote plumbing.Hash
+		Ahead, Behind int
+	}{
+		{"diverged", local, remote, 3, 2},
+		{"same", remote, remote, 0, 0},
+		{"behind", merged, remote, 0, 2},
+		{"ahead", remote, merged, 2, 0},
+		{"fork", fork, local, 0, 4},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			ahead, behind, err := gitAheadBehind(repo, tc.Local, tc.Remote)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ahead != tc.Ahead || behind != tc.Behind {
+				t.Errorf("Expected %d ahead and %d behind, got %d and %d", tc.Ahead, tc.Behind, ahead, behind)
+			}
+		})
+	}
+}
+
+func TestGitBuildsMatchHeadUsesTargetBranch(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"https://example.com/project.git"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// HEAD is on master, one commit ahead of origin/main
+	pushed := testCommit(t, repo, 0)
+	head := testCommit(t, repo, 1, pushed)
+	refs := []*plumbing.Reference{
+		plumbing.NewHashReference(plumbing.NewBranchReferenceName("master"), head),
+		plumbing.NewHashReference(plumbing.NewRemoteReferenceName("origin", "main"), pushed),
+	}
+	for _, ref := range refs {
+		if err := repo.Storer.SetReference(ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	settings := &BuildTargetSettings{}
+	settings.Scm.Branch = "main"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/orgs/org/projects/project/buildtargets":
+			json.NewEncoder(w).Encode([]BuildTarget{{Id: "android", Settings: settings}, {Id: "ios"}})
+		default:
+			// Reports a different branch than the target's settings
+			targetId := strings.Split(r.URL.Path, "/")[6]
+			json.NewEncoder(w).Encode(Build{TargetId: targetId, Number: 1, Status: "success", ScmBranch: "develop", LastBuiltRevision: pushed.String()})
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestClient()
+	c.BaseURL = srv.URL
+	c.Context.Verbose = true
+
+	cases := []struct {
+		Name     string
+		TargetId string
+		Logged   []string
+	}{
+		{"target branch", "android", []string{
+			"Warning: target android builds branch main, HEAD is on branch master",
+			"HEAD is 1 commits ahead and 0 behind origin/main, which target android builds",
+		}},
+		{"build branch", "ios", []string{
+			"Warning: target ios builds branch develop, HEAD is on branch master",
+			"Could not compare HEAD to branch develop",
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var logged bytes.Buffer
+			log.SetOutput(&logged)
+			defer log.SetOutput(os.Stderr)
+
+			match, err := c.Git_BuildsMatchHead(context.Background(), dir, tc.TargetId, 1, false)
+			if err != nil {
+				t.Fatal(err)
+			} else if match {
+				t.Error("Expected the build not to match HEAD")
+			}
+
+			for _, line := range tc.Logged {
+				if !strings.Contains(logged.String(), line) {
+					t.Errorf("Expected %q to be logged, got:\n%s", line, logged.String())
+				}
+			}
+		})
+	}
+}
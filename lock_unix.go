@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package unitycloudbuild
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on file without waiting for it. The lock
+// is released when file is closed.
+func lockFile(file *os.File) error {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return errFileLocked
+	}
+	return err
+}
@@ -0,0 +1,31 @@
+package unitycloudbuild
+
+import (
+	"math"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+
+	errorLockViolation syscall.Errno = 33
+)
+
+var procLockFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("LockFileEx")
+
+// lockFile takes an exclusive lock on file without waiting for it. The lock
+// is released when file is closed.
+func lockFile(file *os.File) error {
+	// Lock the largest possible range, so that it covers the file as it grows
+	var overlapped syscall.Overlapped
+	r, _, err := procLockFileEx.Call(file.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, math.MaxUint32, math.MaxUint32, uintptr(unsafe.Pointer(&overlapped)))
+	if r != 0 {
+		return nil
+	} else if err == errorLockViolation {
+		return errFileLocked
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+package unitycloudbuild
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"time"
+)
+
+// Builds_Log fetches the log of a build starting at offsetLines and returns
+// it as plain text. If compact is true, only the important parts of the log
+// are returned.
+func (c *Client) Builds_Log(ctx context.Context, buildTargetId string, buildNumber int64, offsetLines int, compact bool) ([]byte, error) {
+	req, err := c.buildRequest(ctx, "GET", fmt.Sprintf("buildtargets/%s/builds/%d/log", buildTargetId, buildNumber), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	q := req.URL.Query()
+	if offsetLines > 0 {
+		q.Add("offsetlines", strconv.Itoa(offsetLines))
+	}
+	if compact {
+		q.Add("compact", "true")
+	}
+	req.URL.RawQuery = q.Encode()
+	req.Header.Set("Accept", "text/plain")
+
+	var body []byte
+	_, err = c.doRequest(req, &body)
+	if err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// logPollInterval is the time between log requests while following a build.
+var logPollInterval = DefaultPollInterval
+
+// Builds_StreamLog writes the log of a build to w. If follow is true and the
+// build is still active, the log is polled until the build finishes.
+func (c *Client) Builds_StreamLog(ctx context.Context, buildTargetId string, buildNumber int64, compact bool, follow bool, w io.Writer) error {
+	lines := 0
+
+	for {
+		// Check status before fetching so the final fetch happens after the build finished
+		active := false
+		if follow {
+			build, err := c.Builds_Status(ctx, buildTargetId, buildNumber)
+			if err != nil {
+				return err
+			}
+			active = IsBuildActive(build)
+		}
+
+		body, err := c.Builds_Log(ctx, buildTargetId, buildNumber, lines, compact)
+		if err != nil {
+			return err
+		}
+
+		// While following, only write complete lines so the next poll can
+		// resume at a line boundary.
+		if active {
+			if i := bytes.LastIndexByte(body, '\n'); i >= 0 {
+				body = body[:i+1]
+			} else {
+				body = nil
+			}
+		}
+
+		if _, err := w.Write(body); err != nil {
+			return err
+		}
+		lines += bytes.Count(body, []byte{'\n'})
+
+		if !active {
+			return nil
+		}
+
+		if c.Context.Verbose {
+			log.Printf("Read %d log lines, polling...", lines)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(logPollInterval):
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package unitycloudbuild
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// logServer serves a build log that grows with each request. The build
+// reports each of statuses in turn, and keeps the last one.
+type logServer struct {
+	mu       sync.Mutex
+	logs     []string
+	statuses []string
+	offsets  []int
+}
+
+func (s *logServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch strings.TrimPrefix(r.URL.Path, "/orgs/org/projects/project/") {
+	case "buildtargets/android/builds/1":
+		build := Build{TargetId: "android", Number: 1, Status: s.statuses[0]}
+		if len(s.statuses) > 1 {
+			s.statuses = s.statuses[1:]
+		}
+		json.NewEncoder(w).Encode(build)
+	case "buildtargets/android/builds/1/log":
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offsetlines"))
+		s.offsets = append(s.offsets, offset)
+
+		lines := strings.SplitAfter(s.logs[0], "\n")
+		if len(s.logs) > 1 {
+			s.logs = s.logs[1:]
+		}
+		if offset > len(lines) {
+			offset = len(lines)
+		}
+		w.Write([]byte(strings.Join(lines[offset:], "")))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestBuildsStreamLogFollow(t *testing.T) {
+	defer func(interval time.Duration) { logPollInterval = interval }(logPollInterval)
+	logPollInterval = time.Millisecond
+
+	server := &logServer{
+		statuses: []string{"started", "started", "success"},
+		logs: []string{
+			"line 1\nline 2\nline 3 is writ",
+			"line 1\nline 2\nline 3 is written\nline 4\n",
+			"line 1\nline 2\nline 3 is written\nline 4\nline 5\nline 6",
+		},
+	}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	c := newTestClient()
+	c.BaseURL = srv.URL
+
+	var out bytes.Buffer
+	if err := c.Builds_StreamLog(context.Background(), "android", 1, false, true, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "line 1\nline 2\nline 3 is written\nline 4\nline 5\nline 6"
+	if out.String() != expected {
+		t.Errorf("Expected every line exactly once:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.offsets) != 3 || server.offsets[0] != 0 || server.offsets[1] != 2 || server.offsets[2] != 4 {
+		t.Errorf("Expected each poll to resume after the lines already read, got offsets %v", server.offsets)
+	}
+}
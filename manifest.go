@@ -0,0 +1,315 @@
+package unitycloudbuild
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+)
+
+// manifestElements are the AndroidManifest.xml elements whose attributes are
+// collected, keyed as "element.attribute", e.g. "manifest.versionCode".
+var manifestElements = map[string]bool{
+	"manifest": true,
+	"uses-sdk": true,
+}
+
+func addManifestAttribute(values map[string]string, element string, name string, value string) {
+	if !manifestElements[element] {
+		return
+	}
+
+	key := element + "." + name
+	if _, ok := values[key]; !ok {
+		values[key] = value
+	}
+}
+
+const (
+	axmlTypeStringPool   = 0x0001
+	axmlTypeXML          = 0x0003
+	axmlTypeStartElement = 0x0102
+
+	axmlUTF8Flag = 1 << 8
+)
+
+// parseBinaryManifest parses the compiled binary XML AndroidManifest.xml found
+// in an APK.
+func parseBinaryManifest(data []byte) (map[string]string, error) {
+	if len(data) < 8 || binary.LittleEndian.Uint16(data) != axmlTypeXML {
+		return nil, fmt.Errorf("AndroidManifest.xml is not binary XML")
+	}
+
+	values := make(map[string]string)
+	var pool []string
+
+	str := func(index uint32) string {
+		if int(index) < len(pool) {
+			return pool[index]
+		}
+		return ""
+	}
+
+	for pos := int(binary.LittleEndian.Uint16(data[2:])); pos+8 <= len(data); {
+		chunkType := binary.LittleEndian.Uint16(data[pos:])
+		headerSize := int(binary.LittleEndian.Uint16(data[pos+2:]))
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		if size < 8 || headerSize > size || pos+size > len(data) {
+			return nil, fmt.Errorf("Invalid binary XML chunk at %d", pos)
+		}
+		chunk := data[pos : pos+size]
+		pos += size
+
+		switch chunkType {
+		case axmlTypeStringPool:
+			var err error
+			if pool, err = parseStringPool(chunk, headerSize); err != nil {
+				return nil, err
+			}
+		case axmlTypeStartElement:
+			ext := chunk[headerSize:]
+			if len(ext) < 20 {
+				continue
+			}
+
+			element := str(binary.LittleEndian.Uint32(ext[4:]))
+			attributeStart := int(binary.LittleEndian.Uint16(ext[8:]))
+			attributeSize := int(binary.LittleEndian.Uint16(ext[10:]))
+			attributeCount := int(binary.LittleEndian.Uint16(ext[12:]))
+
+			for i := 0; i < attributeCount; i++ {
+				start := attributeStart + i*attributeSize
+				if attributeSize < 20 || start+20 > len(ext) {
+					break
+				}
+				attribute := ext[start:]
+
+				name := str(binary.LittleEndian.Uint32(attribute[4:]))
+				rawValue := binary.LittleEndian.Uint32(attribute[8:])
+				dataType := attribute[15]
+				value := binary.LittleEndian.Uint32(attribute[16:])
+
+				addManifestAttribute(values, element, name, formatAXMLValue(str, rawValue, dataType, value))
+			}
+		}
+	}
+
+	return values, nil
+}
+
+func formatAXMLValue(str func(uint32) string, rawValue uint32, dataType byte, value uint32) string {
+	if rawValue != 0xffffffff {
+		return str(rawValue)
+	}
+
+	switch dataType {
+	case 0x01:
+		return fmt.Sprintf("@0x%08x", value)
+	case 0x03:
+		return str(value)
+	case 0x11:
+		return fmt.Sprintf("0x%x", value)
+	case 0x12:
+		return strconv.FormatBool(value != 0)
+	default:
+		return strconv.FormatInt(int64(int32(value)), 10)
+	}
+}
+
+func parseStringPool(chunk []byte, headerSize int) ([]string, error) {
+	if len(chunk) < 28 {
+		return nil, fmt.Errorf("Binary XML string pool is truncated")
+	}
+
+	count := int(binary.LittleEndian.Uint32(chunk[8:]))
+	flags := binary.LittleEndian.Uint32(chunk[16:])
+	stringsStart := int(binary.LittleEndian.Uint32(chunk[20:]))
+
+	if headerSize+count*4 > len(chunk) || stringsStart > len(chunk) {
+		return nil, fmt.Errorf("Binary XML string pool is truncated")
+	}
+
+	pool := make([]string, count)
+	for i := range pool {
+		offset := stringsStart + int(binary.LittleEndian.Uint32(chunk[headerSize+i*4:]))
+		if offset >= len(chunk) {
+			continue
+		}
+
+		if flags&axmlUTF8Flag != 0 {
+			pool[i] = decodeUTF8PoolString(chunk[offset:])
+		} else {
+			pool[i] = decodeUTF16PoolString(chunk[offset:])
+		}
+	}
+
+	return pool, nil
+}
+
+func decodeUTF8PoolString(b []byte) string {
+	// Both the UTF-16 and UTF-8 lengths precede the string, each one or two
+	// bytes long
+	skipLength := func(b []byte) (int, []byte) {
+		if len(b) == 0 {
+			return 0, nil
+		} else if b[0]&0x80 == 0 {
+			return int(b[0]), b[1:]
+		} else if len(b) < 2 {
+			return 0, nil
+		}
+		return int(b[0]&0x7f)<<8 | int(b[1]), b[2:]
+	}
+
+	_, b = skipLength(b)
+	length, b := skipLength(b)
+	if length > len(b) {
+		return ""
+	}
+	return string(b[:length])
+}
+
+func decodeUTF16PoolString(b []byte) string {
+	if len(b) < 2 {
+		return ""
+	}
+
+	length := int(binary.LittleEndian.Uint16(b))
+	b = b[2:]
+	if length&0x8000 != 0 {
+		if len(b) < 2 {
+			return ""
+		}
+		length = (length&0x7fff)<<16 | int(binary.LittleEndian.Uint16(b))
+		b = b[2:]
+	}
+
+	if length*2 > len(b) {
+		return ""
+	}
+
+	chars := make([]uint16, length)
+	for i := range chars {
+		chars[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(chars))
+}
+
+// parseProtoManifest parses the protobuf encoded AndroidManifest.xml found in
+// an Android App Bundle (aapt2 XmlNode message).
+func parseProtoManifest(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	if err := parseProtoXMLNode(data, values, 0); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// XmlNode { XmlElement element = 1; ... }
+func parseProtoXMLNode(data []byte, values map[string]string, depth int) error {
+	if depth > 2 {
+		// Only the manifest element and its direct children are of interest
+		return nil
+	}
+
+	return protoFields(data, func(field int, value []byte) error {
+		if field == 1 {
+			return parseProtoXMLElement(value, values, depth)
+		}
+		return nil
+	})
+}
+
+// XmlElement { string name = 3; repeated XmlAttribute attribute = 4; repeated XmlNode child = 5; ... }
+func parseProtoXMLElement(data []byte, values map[string]string, depth int) error {
+	var name string
+	var attributes, children [][]byte
+
+	err := protoFields(data, func(field int, value []byte) error {
+		switch field {
+		case 3:
+			name = string(value)
+		case 4:
+			attributes = append(attributes, value)
+		case 5:
+			children = append(children, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// XmlAttribute { string name = 2; string value = 3; ... }
+	for _, attribute := range attributes {
+		var attributeName, attributeValue string
+		err := protoFields(attribute, func(field int, value []byte) error {
+			switch field {
+			case 2:
+				attributeName = string(value)
+			case 3:
+				attributeValue = string(value)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		addManifestAttribute(values, name, attributeName, attributeValue)
+	}
+
+	for _, child := range children {
+		if err := parseProtoXMLNode(child, values, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// protoFields calls fn with each length delimited field of a protobuf
+// message. Other wire types are skipped.
+func protoFields(data []byte, fn func(field int, value []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return fmt.Errorf("Invalid protobuf field key")
+		}
+		data = data[n:]
+
+		field, wireType := int(key>>3), key&7
+
+		switch wireType {
+		case 0:
+			if _, n = binary.Uvarint(data); n <= 0 {
+				return fmt.Errorf("Invalid protobuf varint")
+			}
+			data = data[n:]
+		case 1:
+			if len(data) < 8 {
+				return fmt.Errorf("Protobuf message is truncated")
+			}
+			data = data[8:]
+		case 2:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return fmt.Errorf("Protobuf message is truncated")
+			}
+			value := data[n : n+int(length)]
+			data = data[n+int(length):]
+
+			if err := fn(field, value); err != nil {
+				return err
+			}
+		case 5:
+			if len(data) < 4 {
+				return fmt.Errorf("Protobuf message is truncated")
+			}
+			data = data[4:]
+		default:
+			return fmt.Errorf("Unsupported protobuf wire type %d", wireType)
+		}
+	}
+
+	return nil
+}
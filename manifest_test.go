@@ -0,0 +1,187 @@
+package unitycloudbuild
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// axmlAttribute is an attribute of a binary XML start element. Attributes
+// with a String are stored as a raw string value, others as typed data.
+type axmlAttribute struct {
+	Name     uint32
+	String   uint32
+	DataType byte
+	Data     uint32
+}
+
+func axmlChunk(chunkType uint16, headerSize uint16, body []byte) []byte {
+	chunk := make([]byte, 8, 8+len(body))
+	binary.LittleEndian.PutUint16(chunk, chunkType)
+	binary.LittleEndian.PutUint16(chunk[2:], headerSize)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(8+len(body)))
+	return append(chunk, body...)
+}
+
+func axmlStringPool(pool []string) []byte {
+	header := make([]byte, 20)
+	binary.LittleEndian.PutUint32(header, uint32(len(pool)))
+	binary.LittleEndian.PutUint32(header[8:], axmlUTF8Flag)
+	binary.LittleEndian.PutUint32(header[12:], uint32(28+4*len(pool)))
+
+	var offsets, strings []byte
+	for _, s := range pool {
+		offset := make([]byte, 4)
+		binary.LittleEndian.PutUint32(offset, uint32(len(strings)))
+		offsets = append(offsets, offset...)
+		strings = append(strings, byte(len(s)), byte(len(s)))
+		strings = append(strings, s...)
+		strings = append(strings, 0)
+	}
+
+	body := append(header, offsets...)
+	return axmlChunk(axmlTypeStringPool, 28, append(body, strings...))
+}
+
+func axmlStartElement(name uint32, attributes []axmlAttribute) []byte {
+	body := make([]byte, 28)
+	// Line number and comment, then the namespace
+	binary.LittleEndian.PutUint32(body[4:], math.MaxUint32)
+	binary.LittleEndian.PutUint32(body[8:], math.MaxUint32)
+	binary.LittleEndian.PutUint32(body[12:], name)
+	binary.LittleEndian.PutUint16(body[16:], 20)
+	binary.LittleEndian.PutUint16(body[18:], 20)
+	binary.LittleEndian.PutUint16(body[20:], uint16(len(attributes)))
+
+	for _, attribute := range attributes {
+		b := make([]byte, 20)
+		binary.LittleEndian.PutUint32(b, math.MaxUint32)
+		binary.LittleEndian.PutUint32(b[4:], attribute.Name)
+		binary.LittleEndian.PutUint32(b[8:], math.MaxUint32)
+		binary.LittleEndian.PutUint16(b[12:], 8)
+		b[15] = attribute.DataType
+		binary.LittleEndian.PutUint32(b[16:], attribute.Data)
+		if attribute.DataType == 0x03 {
+			binary.LittleEndian.PutUint32(b[8:], attribute.String)
+			binary.LittleEndian.PutUint32(b[16:], attribute.String)
+		}
+		body = append(body, b...)
+	}
+
+	return axmlChunk(axmlTypeStartElement, 16, body)
+}
+
+func testBinaryManifest() []byte {
+	pool := axmlStringPool([]string{
+		"manifest", "package", "com.example.game", "versionCode", "versionName", "1.2.3", "uses-sdk", "minSdkVersion", "application", "debuggable",
+	})
+
+	body := append(pool, axmlStartElement(0, []axmlAttribute{
+		{Name: 1, String: 2, DataType: 0x03},
+		{Name: 3, DataType: 0x10, Data: 42},
+		{Name: 4, String: 5, DataType: 0x03},
+	})...)
+	body = append(body, axmlStartElement(6, []axmlAttribute{
+		{Name: 7, DataType: 0x10, Data: 21},
+	})...)
+	body = append(body, axmlStartElement(8, []axmlAttribute{
+		{Name: 9, DataType: 0x12, Data: math.MaxUint32},
+	})...)
+
+	return axmlChunk(axmlTypeXML, 8, body)
+}
+
+func TestParseBinaryManifest(t *testing.T) {
+	values, err := parseBinaryManifest(testBinaryManifest())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := androidPackageInfo(values)
+	expected := PackageInfo{Platform: "android", Identifier: "com.example.game", Version: "1.2.3", BuildNumber: "42", MinOSVersion: "21"}
+	if *info != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *info)
+	}
+	if _, ok := values["application.debuggable"]; ok {
+		t.Errorf("Expected attributes of other elements to be skipped")
+	}
+}
+
+func TestParseBinaryManifestTruncated(t *testing.T) {
+	data := testBinaryManifest()
+	for n := 0; n < len(data); n++ {
+		parseBinaryManifest(data[:n])
+	}
+	for i := range data {
+		corrupted := append([]byte(nil), data...)
+		corrupted[i] = 0xff
+		parseBinaryManifest(corrupted)
+	}
+
+	if _, err := parseBinaryManifest([]byte("<manifest/>")); err == nil {
+		t.Errorf("Expected a text manifest to fail")
+	}
+}
+
+func protoField(field int, value []byte) []byte {
+	b := make([]byte, 2*binary.MaxVarintLen64)
+	n := binary.PutUvarint(b, uint64(field<<3|2))
+	n += binary.PutUvarint(b[n:], uint64(len(value)))
+	return append(b[:n], value...)
+}
+
+func protoElement(name string, attributes [][2]string, children ...[]byte) []byte {
+	// A varint line number, which is skipped
+	element := []byte{0x08, 0x01}
+	element = append(element, protoField(3, []byte(name))...)
+	for _, attribute := range attributes {
+		a := append(protoField(2, []byte(attribute[0])), protoField(3, []byte(attribute[1]))...)
+		element = append(element, protoField(4, a)...)
+	}
+	for _, child := range children {
+		element = append(element, protoField(5, child)...)
+	}
+	return protoField(1, element)
+}
+
+func testProtoManifest() []byte {
+	return protoElement("manifest", [][2]string{
+		{"package", "com.example.game"},
+		{"versionCode", "42"},
+		{"versionName", "1.2.3"},
+	},
+		protoElement("uses-sdk", [][2]string{{"minSdkVersion", "21"}}),
+		protoElement("application", nil,
+			protoElement("activity", [][2]string{{"name", "Main"}}),
+		),
+	)
+}
+
+func TestParseProtoManifest(t *testing.T) {
+	values, err := parseProtoManifest(testProtoManifest())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := androidPackageInfo(values)
+	expected := PackageInfo{Platform: "android", Identifier: "com.example.game", Version: "1.2.3", BuildNumber: "42", MinOSVersion: "21"}
+	if *info != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *info)
+	}
+}
+
+func TestParseProtoManifestTruncated(t *testing.T) {
+	data := testProtoManifest()
+	for n := 1; n < len(data); n++ {
+		if _, err := parseProtoManifest(data[:n]); err == nil {
+			t.Errorf("Expected a manifest truncated to %d bytes to fail", n)
+		}
+	}
+
+	if _, err := parseProtoManifest([]byte{0x0a, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}); err == nil {
+		t.Errorf("Expected an overlong length to fail")
+	}
+	if _, err := parseProtoManifest([]byte{0x0b}); err == nil {
+		t.Errorf("Expected an unsupported wire type to fail")
+	}
+}
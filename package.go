@@ -0,0 +1,144 @@
+package unitycloudbuild
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+)
+
+// PackageInfo is the metadata embedded in a mobile package, read from the
+// Info.plist of an .ipa or the AndroidManifest.xml of an .apk or .aab.
+type PackageInfo struct {
+	Platform     string `json:"platform"`
+	Identifier   string `json:"identifier"`
+	Name         string `json:"name,omitempty"`
+	Version      string `json:"version,omitempty"`
+	BuildNumber  string `json:"buildNumber,omitempty"`
+	MinOSVersion string `json:"minOSVersion,omitempty"`
+}
+
+// packageInspectors read the metadata of mobile packages by file type. The
+// packages are zips, but are kept as is instead of being extracted.
+var packageInspectors = map[string]func(*zip.Reader) (*PackageInfo, error){
+	"ipa": inspectIPA,
+	"apk": inspectAPK,
+	"aab": inspectAAB,
+}
+
+// IsPackageType returns true if fileType is a mobile package that can be
+// inspected with InspectPackage.
+func IsPackageType(fileType string) bool {
+	_, ok := packageInspectors[fileType]
+	return ok
+}
+
+// InspectPackage reads the metadata of an .ipa, .apk or .aab file.
+func InspectPackage(filename string, fileType string) (*PackageInfo, error) {
+	inspect, ok := packageInspectors[fileType]
+	if !ok {
+		return nil, fmt.Errorf("Cannot inspect %s, filetype is %s", filename, fileType)
+	}
+
+	zipReader, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer zipReader.Close()
+
+	return inspect(&zipReader.Reader)
+}
+
+var ipaInfoPlistRegex = regexp.MustCompile(`^Payload/[^/]+\.app/Info\.plist$`)
+
+func inspectIPA(zipReader *zip.Reader) (*PackageInfo, error) {
+	data, err := readZipEntry(zipReader, func(name string) bool {
+		return ipaInfoPlistRegex.MatchString(name)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := parsePlist(data)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse Info.plist: %v", err)
+	}
+
+	info := &PackageInfo{
+		Platform:     "ios",
+		Identifier:   values["CFBundleIdentifier"],
+		Name:         values["CFBundleDisplayName"],
+		Version:      values["CFBundleShortVersionString"],
+		BuildNumber:  values["CFBundleVersion"],
+		MinOSVersion: values["MinimumOSVersion"],
+	}
+	if len(info.Name) == 0 {
+		info.Name = values["CFBundleName"]
+	}
+
+	return info, nil
+}
+
+func inspectAPK(zipReader *zip.Reader) (*PackageInfo, error) {
+	data, err := readZipEntry(zipReader, func(name string) bool {
+		return name == "AndroidManifest.xml"
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := parseBinaryManifest(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return androidPackageInfo(values), nil
+}
+
+func inspectAAB(zipReader *zip.Reader) (*PackageInfo, error) {
+	data, err := readZipEntry(zipReader, func(name string) bool {
+		return name == "base/manifest/AndroidManifest.xml"
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := parseProtoManifest(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return androidPackageInfo(values), nil
+}
+
+func androidPackageInfo(values map[string]string) *PackageInfo {
+	return &PackageInfo{
+		Platform:     "android",
+		Identifier:   values["manifest.package"],
+		Version:      values["manifest.versionName"],
+		BuildNumber:  values["manifest.versionCode"],
+		MinOSVersion: values["uses-sdk.minSdkVersion"],
+	}
+}
+
+// maxMetadataSize limits how much of a metadata file is read from a package.
+const maxMetadataSize = 16 * 1024 * 1024
+
+func readZipEntry(zipReader *zip.Reader, match func(name string) bool) ([]byte, error) {
+	for _, zippedFile := range zipReader.File {
+		if !match(zippedFile.Name) {
+			continue
+		}
+
+		fileReader, err := zippedFile.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer fileReader.Close()
+
+		return ioutil.ReadAll(io.LimitReader(fileReader, maxMetadataSize))
+	}
+
+	return nil, fmt.Errorf("Package has no metadata file")
+}
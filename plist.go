@@ -0,0 +1,237 @@
+package unitycloudbuild
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf16"
+)
+
+// parsePlist returns the top level string, integer and boolean values of an
+// XML or binary property list, e.g. an Info.plist. Nested values are skipped.
+func parsePlist(data []byte) (map[string]string, error) {
+	if bytes.HasPrefix(data, []byte("bplist00")) {
+		return parseBinaryPlist(data)
+	}
+	return parseXMLPlist(data)
+}
+
+func parseXMLPlist(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	depth := 0
+	key := ""
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+
+			// <plist><dict> is depth 2, its keys and values are depth 3
+			if depth != 3 {
+				continue
+			}
+
+			switch t.Name.Local {
+			case "key":
+				var s string
+				if err := decoder.DecodeElement(&s, &t); err != nil {
+					return nil, err
+				}
+				key = s
+				depth--
+			case "string", "integer", "real", "date":
+				var s string
+				if err := decoder.DecodeElement(&s, &t); err != nil {
+					return nil, err
+				}
+				values[key] = s
+				depth--
+			case "true", "false":
+				values[key] = t.Name.Local
+				if err := decoder.Skip(); err != nil {
+					return nil, err
+				}
+				depth--
+			default:
+				if err := decoder.Skip(); err != nil {
+					return nil, err
+				}
+				depth--
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+
+	return values, nil
+}
+
+type binaryPlist struct {
+	data          []byte
+	offsets       []uint64
+	objectRefSize int
+}
+
+func parseBinaryPlist(data []byte) (map[string]string, error) {
+	if len(data) < 40 {
+		return nil, fmt.Errorf("Binary plist is truncated")
+	}
+
+	trailer := data[len(data)-32:]
+	offsetIntSize := int(trailer[6])
+	objectRefSize := int(trailer[7])
+	numObjects := binary.BigEndian.Uint64(trailer[8:])
+	topObject := binary.BigEndian.Uint64(trailer[16:])
+	offsetTableOffset := binary.BigEndian.Uint64(trailer[24:])
+
+	// Each value is bounded by the data before it is used in arithmetic, so
+	// that a malformed trailer cannot overflow
+	if offsetIntSize == 0 || offsetIntSize > 8 || objectRefSize == 0 || objectRefSize > 8 ||
+		offsetTableOffset > uint64(len(data)) || numObjects > (uint64(len(data))-offsetTableOffset)/uint64(offsetIntSize) {
+		return nil, fmt.Errorf("Invalid binary plist trailer")
+	}
+
+	p := &binaryPlist{data: data, objectRefSize: objectRefSize, offsets: make([]uint64, numObjects)}
+	for i := range p.offsets {
+		start := offsetTableOffset + uint64(i*offsetIntSize)
+		p.offsets[i] = readUint(data[start : start+uint64(offsetIntSize)])
+	}
+
+	keys, values, err := p.dict(topObject)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string)
+	for i := range keys {
+		key, err := p.scalar(keys[i])
+		if err != nil {
+			return nil, err
+		}
+		if value, err := p.scalar(values[i]); err == nil {
+			result[key] = value
+		}
+	}
+
+	return result, nil
+}
+
+func readUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func (p *binaryPlist) object(ref uint64) (byte, []byte, error) {
+	if ref >= uint64(len(p.offsets)) || p.offsets[ref] >= uint64(len(p.data)) {
+		return 0, nil, fmt.Errorf("Invalid binary plist object reference %d", ref)
+	}
+	return p.data[p.offsets[ref]], p.data[p.offsets[ref]+1:], nil
+}
+
+// length returns the element count of an object, which either fits in the low
+// nibble of its marker or follows it as an integer object.
+func (p *binaryPlist) length(marker byte, rest []byte) (uint64, []byte, error) {
+	if marker&0x0f != 0x0f {
+		return uint64(marker & 0x0f), rest, nil
+	}
+
+	if len(rest) < 1 || rest[0]&0xf0 != 0x10 {
+		return 0, nil, fmt.Errorf("Invalid binary plist length")
+	}
+
+	size := 1 << (rest[0] & 0x0f)
+	if len(rest) < 1+size {
+		return 0, nil, fmt.Errorf("Binary plist is truncated")
+	}
+	return readUint(rest[1 : 1+size]), rest[1+size:], nil
+}
+
+func (p *binaryPlist) dict(ref uint64) ([]uint64, []uint64, error) {
+	marker, rest, err := p.object(ref)
+	if err != nil {
+		return nil, nil, err
+	} else if marker&0xf0 != 0xd0 {
+		return nil, nil, fmt.Errorf("Binary plist root is not a dictionary")
+	}
+
+	count, rest, err := p.length(marker, rest)
+	if err != nil {
+		return nil, nil, err
+	} else if count > uint64(len(rest))/(2*uint64(p.objectRefSize)) {
+		return nil, nil, fmt.Errorf("Binary plist is truncated")
+	}
+
+	keys := make([]uint64, count)
+	values := make([]uint64, count)
+	for i := uint64(0); i < count; i++ {
+		keys[i] = readUint(rest[i*uint64(p.objectRefSize) : (i+1)*uint64(p.objectRefSize)])
+		values[i] = readUint(rest[(count+i)*uint64(p.objectRefSize) : (count+i+1)*uint64(p.objectRefSize)])
+	}
+
+	return keys, values, nil
+}
+
+// scalar returns strings, integers, reals and booleans formatted as strings.
+func (p *binaryPlist) scalar(ref uint64) (string, error) {
+	marker, rest, err := p.object(ref)
+	if err != nil {
+		return "", err
+	}
+
+	switch marker & 0xf0 {
+	case 0x00:
+		switch marker {
+		case 0x08:
+			return "false", nil
+		case 0x09:
+			return "true", nil
+		}
+	case 0x10:
+		size := 1 << (marker & 0x0f)
+		if len(rest) >= size {
+			return strconv.FormatInt(int64(readUint(rest[:size])), 10), nil
+		}
+	case 0x20:
+		size := 1 << (marker & 0x0f)
+		if size == 8 && len(rest) >= 8 {
+			return strconv.FormatFloat(math.Float64frombits(readUint(rest[:8])), 'g', -1, 64), nil
+		} else if size == 4 && len(rest) >= 4 {
+			return strconv.FormatFloat(float64(math.Float32frombits(uint32(readUint(rest[:4])))), 'g', -1, 32), nil
+		}
+	case 0x50:
+		count, rest, err := p.length(marker, rest)
+		if err != nil {
+			return "", err
+		} else if uint64(len(rest)) >= count {
+			return string(rest[:count]), nil
+		}
+	case 0x60:
+		count, rest, err := p.length(marker, rest)
+		if err != nil {
+			return "", err
+		} else if count <= uint64(len(rest))/2 {
+			chars := make([]uint16, count)
+			for i := range chars {
+				chars[i] = binary.BigEndian.Uint16(rest[i*2:])
+			}
+			return string(utf16.Decode(chars)), nil
+		}
+	}
+
+	return "", fmt.Errorf("Unsupported binary plist object 0x%02x", marker)
+}
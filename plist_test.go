@@ -0,0 +1,203 @@
+package unitycloudbuild
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"unicode/utf16"
+)
+
+const testXMLPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>CFBundleIdentifier</key>
+	<string>com.example.game</string>
+	<key>CFBundleVersion</key>
+	<integer>42</integer>
+	<key>UIRequiresFullScreen</key>
+	<true/>
+	<key>UISupportedInterfaceOrientations</key>
+	<array>
+		<string>UIInterfaceOrientationPortrait</string>
+	</array>
+	<key>CFBundleIcons</key>
+	<dict>
+		<key>CFBundleIdentifier</key>
+		<string>nested</string>
+	</dict>
+	<key>CFBundleShortVersionString</key>
+	<string>1.2.3</string>
+</dict>
+</plist>
+`
+
+func TestParseXMLPlist(t *testing.T) {
+	values, err := parsePlist([]byte(testXMLPlist))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectValues(t, values, map[string]string{
+		"CFBundleIdentifier":         "com.example.game",
+		"CFBundleVersion":            "42",
+		"UIRequiresFullScreen":       "true",
+		"CFBundleShortVersionString": "1.2.3",
+	})
+	if _, ok := values["UISupportedInterfaceOrientations"]; ok {
+		t.Errorf("Expected arrays to be skipped")
+	}
+}
+
+func TestParseXMLPlistMalformed(t *testing.T) {
+	if _, err := parsePlist([]byte(testXMLPlist[:len(testXMLPlist)/2])); err == nil {
+		t.Errorf("Expected a truncated plist to fail")
+	}
+	if _, err := parsePlist([]byte("<plist><dict><key>a</string></dict></plist>")); err == nil {
+		t.Errorf("Expected mismatched elements to fail")
+	}
+}
+
+// buildBinaryPlist encodes objects, whose first entry is the top level
+// object, with 2 byte offsets and 1 byte object references.
+func buildBinaryPlist(objects [][]byte) []byte {
+	data := []byte("bplist00")
+
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = len(data)
+		data = append(data, object...)
+	}
+
+	offsetTableOffset := len(data)
+	for _, offset := range offsets {
+		data = append(data, byte(offset>>8), byte(offset))
+	}
+
+	trailer := make([]byte, 32)
+	trailer[6] = 2
+	trailer[7] = 1
+	binary.BigEndian.PutUint64(trailer[8:], uint64(len(objects)))
+	binary.BigEndian.PutUint64(trailer[16:], 0)
+	binary.BigEndian.PutUint64(trailer[24:], uint64(offsetTableOffset))
+	return append(data, trailer...)
+}
+
+// bplistMarker encodes an object marker, with a following integer length if
+// it does not fit in the low nibble.
+func bplistMarker(marker byte, length int) []byte {
+	if length < 15 {
+		return []byte{marker | byte(length)}
+	}
+	return []byte{marker | 0x0f, 0x10, byte(length)}
+}
+
+func bplistString(s string) []byte {
+	return append(bplistMarker(0x50, len(s)), s...)
+}
+
+func bplistUnicode(s string) []byte {
+	chars := utf16.Encode([]rune(s))
+	b := bplistMarker(0x60, len(chars))
+	for _, c := range chars {
+		b = append(b, byte(c>>8), byte(c))
+	}
+	return b
+}
+
+func testBinaryPlist() []byte {
+	real := make([]byte, 9)
+	real[0] = 0x23
+	binary.BigEndian.PutUint64(real[1:], math.Float64bits(1.5))
+
+	return buildBinaryPlist([][]byte{
+		// Keys 1-5, values 6-10
+		{0xd5, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		bplistString("CFBundleIdentifier"),
+		bplistString("CFBundleVersion"),
+		bplistString("UIRequiresFullScreen"),
+		bplistString("CFBundleDisplayName"),
+		bplistString("Scale"),
+		bplistString("com.example.game"),
+		{0x11, 0x01, 0x00},
+		{0x09},
+		bplistUnicode("Gäme"),
+		real,
+	})
+}
+
+func TestParseBinaryPlist(t *testing.T) {
+	values, err := parsePlist(testBinaryPlist())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectValues(t, values, map[string]string{
+		"CFBundleIdentifier":   "com.example.game",
+		"CFBundleVersion":      "256",
+		"UIRequiresFullScreen": "true",
+		"CFBundleDisplayName":  "Gäme",
+		"Scale":                "1.5",
+	})
+}
+
+func TestParseBinaryPlistTruncated(t *testing.T) {
+	data := testBinaryPlist()
+	for n := 0; n < len(data); n++ {
+		parsePlist(data[:n])
+	}
+	for i := range data {
+		corrupted := append([]byte(nil), data...)
+		corrupted[i] = 0xff
+		parsePlist(corrupted)
+	}
+}
+
+func TestParseBinaryPlistMalformed(t *testing.T) {
+	trailer := func(data []byte, offsetIntSize byte, numObjects uint64, offsetTableOffset uint64) []byte {
+		data = append([]byte(nil), data...)
+		t := data[len(data)-32:]
+		t[6] = offsetIntSize
+		binary.BigEndian.PutUint64(t[8:], numObjects)
+		binary.BigEndian.PutUint64(t[24:], offsetTableOffset)
+		return data
+	}
+
+	valid := testBinaryPlist()
+	cases := map[string][]byte{
+		"offset table overflow": trailer(valid, 8, 1, math.MaxUint64-7),
+		"object count overflow": trailer(valid, 8, 1<<61, 8),
+		"offset table past end": trailer(valid, 2, 11, uint64(len(valid))),
+		"dictionary count overflow": buildBinaryPlist([][]byte{
+			{0xdf, 0x13, 0x80, 0, 0, 0, 0, 0, 0, 0, 1, 1},
+		}),
+		"unicode count overflow": buildBinaryPlist([][]byte{
+			{0xd1, 1, 2},
+			bplistString("a"),
+			{0x6f, 0x13, 0x80, 0, 0, 0, 0, 0, 0, 0},
+		}),
+		"root is not a dictionary": buildBinaryPlist([][]byte{bplistString("a")}),
+		"object reference past end": buildBinaryPlist([][]byte{
+			{0xd1, 1, 9},
+			bplistString("a"),
+		}),
+	}
+
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			values, err := parsePlist(data)
+			if err == nil && len(values) > 0 {
+				t.Errorf("Expected no values, got %v", values)
+			}
+		})
+	}
+}
+
+func expectValues(t *testing.T, values map[string]string, expected map[string]string) {
+	t.Helper()
+	for key, value := range expected {
+		if values[key] != value {
+			t.Errorf("Expected %s to be %q, got %q", key, value, values[key])
+		}
+	}
+}
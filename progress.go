@@ -0,0 +1,126 @@
+package unitycloudbuild
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// DownloadProgress is reported periodically while a file is downloaded.
+type DownloadProgress struct {
+	Filename   string
+	Downloaded int64
+
+	// Total is -1 if the size is unknown.
+	Total int64
+
+	// Rate is in bytes per second, measured since the download (re)started.
+	Rate float64
+	ETA  time.Duration
+	Done bool
+}
+
+func (p DownloadProgress) Percent() float64 {
+	if p.Total <= 0 {
+		return 0
+	}
+	return float64(p.Downloaded) / float64(p.Total) * 100
+}
+
+type ProgressFunc func(progress DownloadProgress)
+
+const progressInterval = time.Millisecond * 500
+
+// progressWriter counts bytes written and reports progress at most once per
+// progressInterval.
+type progressWriter struct {
+	w          io.Writer
+	progress   ProgressFunc
+	filename   string
+	downloaded int64
+	total      int64
+
+	started      time.Time
+	startedAt    int64
+	lastReported time.Time
+}
+
+func newProgressWriter(w io.Writer, progress ProgressFunc, filename string, downloaded int64, total int64) *progressWriter {
+	now := time.Now()
+	return &progressWriter{
+		w:          w,
+		progress:   progress,
+		filename:   filename,
+		downloaded: downloaded,
+		total:      total,
+		started:    now,
+		startedAt:  downloaded,
+	}
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.downloaded += int64(n)
+
+	if p.progress != nil && time.Since(p.lastReported) >= progressInterval {
+		p.report(false)
+	}
+
+	return n, err
+}
+
+func (p *progressWriter) report(done bool) {
+	if p.progress == nil {
+		return
+	}
+
+	p.lastReported = time.Now()
+
+	progress := DownloadProgress{
+		Filename:   p.filename,
+		Downloaded: p.downloaded,
+		Total:      p.total,
+		Done:       done,
+	}
+
+	if elapsed := time.Since(p.started).Seconds(); elapsed > 0 {
+		progress.Rate = float64(p.downloaded-p.startedAt) / elapsed
+	}
+
+	if progress.Rate > 0 && p.total > 0 {
+		progress.ETA = time.Duration(float64(p.total-p.downloaded)/progress.Rate) * time.Second
+	}
+
+	p.progress(progress)
+}
+
+// NewProgressBar returns a ProgressFunc that draws a single line progress bar
+// to w, e.g. os.Stderr.
+func NewProgressBar(w io.Writer) ProgressFunc {
+	const width = 30
+
+	return func(p DownloadProgress) {
+		var line string
+		if p.Total > 0 {
+			filled := int(p.Percent() / 100 * width)
+			if filled > width {
+				filled = width
+			}
+			line = fmt.Sprintf("[%s%s] %3.0f%% %s / %s  %s/s",
+				strings.Repeat("=", filled), strings.Repeat(" ", width-filled), p.Percent(),
+				formatBytes(p.Downloaded), formatBytes(p.Total), formatBytes(int64(p.Rate)))
+			if !p.Done && p.ETA > 0 {
+				line += fmt.Sprintf("  ETA %v", p.ETA)
+			}
+		} else {
+			line = fmt.Sprintf("%s  %s/s", formatBytes(p.Downloaded), formatBytes(int64(p.Rate)))
+		}
+
+		// Pad to clear the remains of a longer previous line
+		fmt.Fprintf(w, "\r%-90s", line)
+		if p.Done {
+			fmt.Fprintln(w)
+		}
+	}
+}
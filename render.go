@@ -0,0 +1,327 @@
+package unitycloudbuild
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Renderer formats data returned by the Client, e.g. []Build, []BuildTarget
+// or map[string]*Build, and writes it to w.
+type Renderer interface {
+	Render(w io.Writer, v interface{}) error
+}
+
+// NewRenderer returns the renderer for format. Columns is only used by the
+// table and CSV formats.
+func NewRenderer(format OutputFormat, columns []string) Renderer {
+	switch format {
+	case OutputFormat_JSON:
+		return JSONRenderer{}
+	case OutputFormat_Human:
+		return HumanRenderer{}
+	case OutputFormat_Table:
+		return TableRenderer{Columns: columns}
+	case OutputFormat_CSV:
+		return CSVRenderer{Columns: columns}
+	case OutputFormat_YAML:
+		return YAMLRenderer{}
+	default:
+		return noneRenderer{}
+	}
+}
+
+type noneRenderer struct{}
+
+func (noneRenderer) Render(w io.Writer, v interface{}) error {
+	return nil
+}
+
+type JSONRenderer struct{}
+
+func (JSONRenderer) Render(w io.Writer, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+type YAMLRenderer struct{}
+
+func (YAMLRenderer) Render(w io.Writer, v interface{}) error {
+	// Round trip through JSON so that keys match the JSON output
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var generic interface{}
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return err
+	}
+
+	b, err = yaml.Marshal(generic)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+// TemplateRenderer executes a text/template once per item, e.g. once per
+// build in a []Build, followed by a newline.
+type TemplateRenderer struct {
+	Template *template.Template
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"duration": func(seconds float64) string {
+		return (time.Second * time.Duration(seconds)).String()
+	},
+	"join": strings.Join,
+}
+
+func NewTemplateRenderer(format string) (*TemplateRenderer, error) {
+	tmpl, err := template.New("format").Funcs(templateFuncs).Parse(format)
+	if err != nil {
+		return nil, err
+	}
+	return &TemplateRenderer{Template: tmpl}, nil
+}
+
+func (r *TemplateRenderer) Render(w io.Writer, v interface{}) error {
+	for _, item := range templateItems(v) {
+		if err := r.Template.Execute(w, item); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// templateItems splits v into the values the template is executed with.
+// Targets without a build in a map[string]*Build are skipped.
+func templateItems(v interface{}) []interface{} {
+	if builds, ok := v.(map[string]*Build); ok {
+		var items []interface{}
+		for _, targetId := range sortedBuildKeys(builds) {
+			if build := builds[targetId]; build != nil {
+				items = append(items, build)
+			}
+		}
+		return items
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return []interface{}{v}
+	}
+
+	items := make([]interface{}, rv.Len())
+	for i := range items {
+		items[i] = rv.Index(i).Interface()
+	}
+	return items
+}
+
+type HumanRenderer struct{}
+
+func (r HumanRenderer) Render(w io.Writer, v interface{}) error {
+	switch v := v.(type) {
+	case Build:
+		outputBuild(w, v)
+		fmt.Fprintln(w)
+	case *Build:
+		outputBuild(w, *v)
+		fmt.Fprintln(w)
+	case []Build:
+		for _, build := range v {
+			outputBuild(w, build)
+			fmt.Fprintln(w)
+		}
+	case *BuildAttempt:
+		return r.Render(w, []BuildAttempt{*v})
+	case []BuildAttempt:
+		for _, buildAttempt := range v {
+			if len(buildAttempt.Error) > 0 {
+				fmt.Fprintf(w, "Target: %s\n", buildAttempt.Build.TargetId)
+				fmt.Fprintf(w, "  Error: %s\n", buildAttempt.Error)
+			} else {
+				outputBuild(w, buildAttempt.Build)
+			}
+			fmt.Fprintln(w)
+		}
+	case map[string]*Build:
+		for _, targetId := range sortedBuildKeys(v) {
+			build := v[targetId]
+			if build != nil {
+				outputBuild(w, *build)
+			} else {
+				fmt.Fprintf(w, "Target: %s\n", targetId)
+				fmt.Fprintf(w, "  <No builds successful>\n")
+			}
+
+			fmt.Fprintln(w)
+		}
+	case []BuildTarget:
+		for _, target := range v {
+			fmt.Fprintf(w, "Target: %s\n", target.Name)
+			fmt.Fprintf(w, "  ID:        %s\n", target.Id)
+			fmt.Fprintf(w, "  Enabled:   %v\n", target.Enabled)
+			if target.Settings != nil {
+				fmt.Fprintf(w, "  AutoBuild: %v\n", target.Settings.AutoBuild)
+				fmt.Fprintf(w, "  Branch:    %s\n", target.Settings.Scm.Branch)
+				fmt.Fprintf(w, "  Unity:     %s\n", strings.Replace(target.Settings.UnityVersion, "_", ".", -1))
+			}
+			fmt.Fprintln(w)
+		}
+	case []Artifact:
+		for _, artifact := range v {
+			fmt.Fprintf(w, "Artifact: %s (key=%s)\n", artifact.Name, artifact.Key)
+			for _, file := range artifact.Files {
+				fmt.Fprintf(w, "  %-40s %s\n", file.Filename, formatBytes(file.Size))
+			}
+			fmt.Fprintln(w)
+		}
+	case []BuildFailure:
+		if len(v) == 0 {
+			fmt.Fprintln(w, "No errors found.")
+		}
+		for _, failure := range v {
+			fmt.Fprintln(w, failure)
+		}
+	case []DownloadedFile:
+		for _, file := range v {
+			switch file.Action {
+			case DownloadAction_Extracted:
+				fmt.Fprintf(w, "Extracted: %s (%s) to %s\n", file.Filename, formatBytes(file.Size), file.Path)
+			default:
+				fmt.Fprintf(w, "Saved:     %s (%s)\n", file.Path, formatBytes(file.Size))
+			}
+			if file.Cached {
+				fmt.Fprintf(w, "  From cache\n")
+			}
+			if p := file.Package; p != nil {
+				fmt.Fprintf(w, "  Package:  %s (%s)\n", p.Identifier, p.Platform)
+				if len(p.Name) > 0 {
+					fmt.Fprintf(w, "  Name:     %s\n", p.Name)
+				}
+				fmt.Fprintf(w, "  Version:  %s (%s)\n", p.Version, p.BuildNumber)
+				if len(p.MinOSVersion) > 0 {
+					fmt.Fprintf(w, "  Min OS:   %s\n", p.MinOSVersion)
+				}
+			}
+		}
+	case []TargetDownload:
+		succeeded := 0
+		for _, download := range v {
+			if download.Build != nil {
+				fmt.Fprintf(w, "Target: %s, (Build #%d)\n", download.TargetId, download.Build.Number)
+			} else {
+				fmt.Fprintf(w, "Target: %s\n", download.TargetId)
+			}
+			if len(download.OutputDir) > 0 {
+				fmt.Fprintf(w, "  Output: %s\n", download.OutputDir)
+			}
+			if len(download.Error) > 0 {
+				fmt.Fprintf(w, "  Error:  %s\n", download.Error)
+			} else {
+				fmt.Fprintf(w, "  Files:  %d\n", len(download.Files))
+				succeeded++
+			}
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "Downloaded %d of %d targets.\n", succeeded, len(v))
+	case []CacheEntry:
+		if len(v) == 0 {
+			fmt.Fprintln(w, "No cached builds.")
+		}
+		for _, entry := range v {
+			fmt.Fprintf(w, "Target: %s, (Build #%d)\n", entry.TargetId, entry.BuildNumber)
+			fmt.Fprintf(w, "  GUID:      %s\n", entry.GUID)
+			fmt.Fprintf(w, "  Last used: %v\n", entry.LastUsed)
+			fmt.Fprintf(w, "  Dir:       %s\n", entry.Dir)
+			for _, file := range entry.Files {
+				fmt.Fprintf(w, "  %-40s %s\n", file.Filename, formatBytes(file.Size))
+			}
+			fmt.Fprintln(w)
+		}
+	case *CacheSize:
+		fmt.Fprintf(w, "%s: %d builds, %d files, %s\n", v.Dir, v.Entries, v.Files, formatBytes(v.Size))
+	case *GitCommit:
+		fmt.Fprintf(w, "Revision: %s\n", v.Revision)
+		if len(v.Branch) > 0 {
+			fmt.Fprintf(w, "Branch:   %s\n", v.Branch)
+		} else {
+			fmt.Fprintf(w, "Branch:   <detached>\n")
+		}
+		if len(v.Tags) > 0 {
+			fmt.Fprintf(w, "Tags:     %s\n", strings.Join(v.Tags, ", "))
+		}
+		fmt.Fprintf(w, "Author:   %s\n", v.Author)
+		fmt.Fprintf(w, "Time:     %v\n", v.Time)
+		fmt.Fprintf(w, "Dirty:    %v\n", v.Dirty)
+		if v.TargetBranch != nil {
+			fmt.Fprintf(w, "Target:   %s, %d ahead, %d behind\n", v.TargetBranch.Remote, v.TargetBranch.Ahead, v.TargetBranch.Behind)
+		}
+		fmt.Fprintf(w, "Message:  %s\n", v.Message)
+	default:
+		return fmt.Errorf("Cannot render %T", v)
+	}
+
+	return nil
+}
+
+func outputBuild(w io.Writer, build Build) {
+	fmt.Fprintf(w, "Target: %s, (Build #%d)\n", build.TargetId, build.Number)
+	fmt.Fprintf(w, "  Created:  %v\n", build.Created)
+	fmt.Fprintf(w, "  GUID:     %s\n", build.GUID)
+	fmt.Fprintf(w, "  Status:   %s\n", build.Status)
+	fmt.Fprintf(w, "  Time:     %v\n", time.Second*time.Duration(build.TotalTimeSeconds))
+	if len(build.LastBuiltRevision) > 0 {
+		fmt.Fprintf(w, "  Revision: %s\n", build.LastBuiltRevision)
+	}
+	if build.Links.DownloadPrimary != nil {
+		fmt.Fprintf(w, "  Download: %s\n", build.Links.DownloadPrimary.Href)
+	}
+}
+
+func sortedBuildKeys(builds map[string]*Build) []string {
+	ids := make([]string, 0, len(builds))
+	for id := range builds {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for i := n / unit; i >= unit; i /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,277 @@
+package unitycloudbuild
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testBuilds are rendered by the golden tests of each output format.
+func testBuilds() []Build {
+	created := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	download := &Link{Method: "get", Href: "https://example.com/android.apk"}
+	download.Meta.Type = "APK"
+
+	return []Build{
+		{
+			Number:            12,
+			TargetId:          "android",
+			TargetName:        "Android",
+			GUID:              "1b3c5e7a",
+			Created:           created,
+			Status:            "success",
+			Finished:          created.Add(754 * time.Second),
+			Platform:          "android",
+			TotalTimeSeconds:  754.2,
+			BuildTimeSeconds:  700,
+			Links:             Links{DownloadPrimary: download},
+			ScmBranch:         "main",
+			LastBuiltRevision: "5c1d9e07a3c04f8be2f1c4a7e56b2d7f0b1e9a43",
+			UnityVersion:      "2019_4_1f1",
+		},
+		{
+			Number:           3,
+			TargetId:         "ios",
+			TargetName:       "iOS",
+			Created:          created.Add(time.Minute),
+			Status:           "started",
+			Platform:         "ios",
+			TotalTimeSeconds: 61,
+			ScmBranch:        "release/1.2",
+			UnityVersion:     "2019_4_1f1",
+		},
+	}
+}
+
+func renderString(t *testing.T, renderer Renderer, v interface{}) string {
+	t.Helper()
+
+	var b bytes.Buffer
+	if err := renderer.Render(&b, v); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestJSONRenderer(t *testing.T) {
+	expected := `[
+    {
+        "build": 12,
+        "buildTargetId": "android",
+        "buildTargetName": "Android",
+        "buildGUID": "1b3c5e7a",
+        "created": "2020-03-04T05:06:07Z",
+        "buildStatus": "success",
+        "finished": "2020-03-04T05:18:41Z",
+        "platform": "android",
+        "totalTimeInSeconds": 754.2,
+        "buildTimeInSeconds": 700,
+        "links": {
+            "download_primary": {
+                "method": "get",
+                "href": "https://example.com/android.apk",
+                "meta": {
+                    "type": "APK"
+                }
+            }
+        },
+        "scmBranch": "main",
+        "lastBuiltRevision": "5c1d9e07a3c04f8be2f1c4a7e56b2d7f0b1e9a43",
+        "unityVersion": "2019_4_1f1"
+    },
+    {
+        "build": 3,
+        "buildTargetId": "ios",
+        "buildTargetName": "iOS",
+        "created": "2020-03-04T05:07:07Z",
+        "buildStatus": "started",
+        "finished": "0001-01-01T00:00:00Z",
+        "platform": "ios",
+        "totalTimeInSeconds": 61,
+        "buildTimeInSeconds": 0,
+        "links": {},
+        "scmBranch": "release/1.2",
+        "unityVersion": "2019_4_1f1"
+    }
+]
+`
+	if output := renderString(t, NewRenderer(OutputFormat_JSON, nil), testBuilds()); output != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, output)
+	}
+}
+
+func TestHumanRenderer(t *testing.T) {
+	builds := testBuilds()
+
+	cases := []struct {
+		Name     string
+		Value    interface{}
+		Expected string
+	}{
+		{"builds", builds, "" +
+			"Target: android, (Build #12)\n" +
+			"  Created:  2020-03-04 05:06:07 +0000 UTC\n" +
+			"  GUID:     1b3c5e7a\n" +
+			"  Status:   success\n" +
+			"  Time:     12m34s\n" +
+			"  Revision: 5c1d9e07a3c04f8be2f1c4a7e56b2d7f0b1e9a43\n" +
+			"  Download: https://example.com/android.apk\n" +
+			"\n" +
+			"Target: ios, (Build #3)\n" +
+			"  Created:  2020-03-04 05:07:07 +0000 UTC\n" +
+			"  GUID:     \n" +
+			"  Status:   started\n" +
+			"  Time:     1m1s\n" +
+			"\n"},
+		{"latest", map[string]*Build{"windows": nil, "ios": &builds[1]}, "" +
+			"Target: ios, (Build #3)\n" +
+			"  Created:  2020-03-04 05:07:07 +0000 UTC\n" +
+			"  GUID:     \n" +
+			"  Status:   started\n" +
+			"  Time:     1m1s\n" +
+			"\n" +
+			"Target: windows\n" +
+			"  <No builds successful>\n" +
+			"\n"},
+		{"attempts", []BuildAttempt{{Build: Build{TargetId: "webgl"}, Error: "Target is disabled"}}, "" +
+			"Target: webgl\n" +
+			"  Error: Target is disabled\n" +
+			"\n"},
+		{"artifacts", []Artifact{{Key: "symbols", Name: "Symbols", Files: []File{{Filename: "symbols.zip", Size: 5 * 1024 * 1024}}}}, "" +
+			"Artifact: Symbols (key=symbols)\n" +
+			"  symbols.zip                              5.0 MiB\n" +
+			"\n"},
+		{"cache size", &CacheSize{Dir: "/cache", Entries: 3, Files: 4, Size: 1536}, "" +
+			"/cache: 3 builds, 4 files, 1.5 KiB\n"},
+		{"no failures", []BuildFailure{}, "No errors found.\n"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			if output := renderString(t, NewRenderer(OutputFormat_Human, nil), tc.Value); output != tc.Expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tc.Expected, output)
+			}
+		})
+	}
+
+	if err := (HumanRenderer{}).Render(&bytes.Buffer{}, 42); err == nil {
+		t.Error("Expected an error for an unsupported type")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	cases := map[int64]string{
+		0:                          "0 B",
+		1023:                       "1023 B",
+		1024:                       "1.0 KiB",
+		1536:                       "1.5 KiB",
+		1024 * 1024:                "1.0 MiB",
+		3 * 1024 * 1024 * 1024 / 2: "1.5 GiB",
+		1 << 40:                    "1.0 TiB",
+		1 << 62:                    "4.0 EiB",
+	}
+
+	for n, expected := range cases {
+		if formatted := formatBytes(n); formatted != expected {
+			t.Errorf("Expected %d to be formatted as %s, got %s", n, expected, formatted)
+		}
+	}
+}
+
+func TestYAMLRenderer(t *testing.T) {
+	expected := `- build: 12
+  buildGUID: 1b3c5e7a
+  buildStatus: success
+  buildTargetId: android
+  buildTargetName: Android
+  buildTimeInSeconds: 700
+  created: "2020-03-04T05:06:07Z"
+  finished: "2020-03-04T05:18:41Z"
+  lastBuiltRevision: 5c1d9e07a3c04f8be2f1c4a7e56b2d7f0b1e9a43
+  links:
+    download_primary:
+      href: https://example.com/android.apk
+      meta:
+        type: APK
+      method: get
+  platform: android
+  scmBranch: main
+  totalTimeInSeconds: 754.2
+  unityVersion: 2019_4_1f1
+- build: 3
+  buildStatus: started
+  buildTargetId: ios
+  buildTargetName: iOS
+  buildTimeInSeconds: 0
+  created: "2020-03-04T05:07:07Z"
+  finished: "0001-01-01T00:00:00Z"
+  links: {}
+  platform: ios
+  scmBranch: release/1.2
+  totalTimeInSeconds: 61
+  unityVersion: 2019_4_1f1
+`
+	if output := renderString(t, NewRenderer(OutputFormat_YAML, nil), testBuilds()); output != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, output)
+	}
+}
+
+func TestTemplateRenderer(t *testing.T) {
+	builds := testBuilds()
+
+	cases := []struct {
+		Name     string
+		Format   string
+		Value    interface{}
+		Expected string
+	}{
+		{"builds", "{{.TargetId}} #{{.Number}} {{.Status}} {{duration .TotalTimeSeconds}}", builds, "" +
+			"android #12 success 12m34s\n" +
+			"ios #3 started 1m1s\n"},
+		{"single build", "{{.GUID}}", &builds[0], "1b3c5e7a\n"},
+		{"latest skips missing", "{{.TargetId}}", map[string]*Build{"windows": nil, "ios": &builds[1], "android": &builds[0]}, "" +
+			"android\n" +
+			"ios\n"},
+		{"json", "{{json .Links.DownloadPrimary.Meta}}", builds[:1], `{"type":"APK"}` + "\n"},
+		{"join", "{{join .Tags \",\"}}", &GitCommit{Tags: []string{"v1.0", "release"}}, "v1.0,release\n"},
+		{"empty", "{{.TargetId}}", []Build{}, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			renderer, err := NewTemplateRenderer(tc.Format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output := renderString(t, renderer, tc.Value); output != tc.Expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tc.Expected, output)
+			}
+		})
+	}
+}
+
+func TestTemplateRendererErrors(t *testing.T) {
+	if _, err := NewTemplateRenderer("{{.TargetId"); err == nil {
+		t.Error("Expected a parse error")
+	}
+	if _, err := NewTemplateRenderer("{{size .}}"); err == nil || !strings.Contains(err.Error(), `function "size" not defined`) {
+		t.Errorf("Expected an error for an unknown function, got %v", err)
+	}
+
+	renderer, err := NewTemplateRenderer("{{.TargetId}} {{.Size}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rendering stops at the first item that fails
+	var b bytes.Buffer
+	err = renderer.Render(&b, testBuilds())
+	if err == nil || !strings.Contains(err.Error(), "can't evaluate field Size") {
+		t.Errorf("Expected an execution error, got %v", err)
+	}
+	if output := b.String(); strings.Contains(output, "ios") {
+		t.Errorf("Expected rendering to stop at the first build, got %q", output)
+	}
+}
@@ -0,0 +1,93 @@
+package unitycloudbuild
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy controls how failed API requests are retried. Requests are
+// retried on network errors, rate limiting (HTTP 429) and server errors (5xx).
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first. A
+	// value <= 1 disables retries.
+	MaxAttempts int
+	BaseDelay   time.Duration
+
+	// MaxDelay caps the time between attempts. A rate limited response that
+	// asks to wait longer is not retried, its error is returned instead.
+	MaxDelay time.Duration
+
+	// By default only idempotent methods (GET, HEAD, DELETE) are retried.
+	RetryNonIdempotent bool
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   time.Second,
+	MaxDelay:    time.Second * 30,
+}
+
+func (p RetryPolicy) shouldRetry(method string, attempt int, err error) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+
+	switch method {
+	case "GET", "HEAD", "DELETE":
+		// idempotent
+	default:
+		if !p.RetryNonIdempotent {
+			return false
+		}
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.StatusCode == http.StatusTooManyRequests {
+			return p.MaxDelay <= 0 || rateLimitDelay(apiErr) <= p.MaxDelay
+		}
+		return apiErr.IsServerError()
+	}
+
+	var decodeErr *DecodeError
+	return !errors.As(err, &decodeErr)
+}
+
+// delay returns how long to wait before the next attempt. Rate limited
+// responses honor Retry-After/X-RateLimit-Reset, otherwise exponential backoff
+// with jitter is used.
+func (p RetryPolicy) delay(attempt int, err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests {
+		if d := rateLimitDelay(apiErr); d > 0 {
+			return d
+		}
+	}
+
+	d := p.BaseDelay << uint(attempt-1)
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	// Jitter the delay into the range [d/2, d]
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// rateLimitDelay returns how long a rate limited response asks to wait, or 0
+// if it does not say.
+func rateLimitDelay(apiErr *APIError) time.Duration {
+	if apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter
+	} else if !apiErr.RateLimitReset.IsZero() {
+		if d := time.Until(apiErr.RateLimitReset); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,158 @@
+package unitycloudbuild
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// retryServer answers with the given status codes in turn, then with 200. The
+// Retry-After header is sent with 429 responses if retryAfter is set.
+func retryServer(t *testing.T, retryAfter int, statuses ...int) (*Client, *int32) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&requests, 1))
+		if body, _ := ioutil.ReadAll(r.Body); r.Method == "POST" && string(body) != `{"key":"value"}` {
+			http.Error(w, `{"error":"missing body"}`, http.StatusBadRequest)
+			return
+		}
+		if n > len(statuses) {
+			w.Write([]byte(`{}`))
+			return
+		}
+
+		if statuses[n-1] == http.StatusTooManyRequests && retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		}
+		http.Error(w, `{"error":"try again"}`, statuses[n-1])
+	}))
+	t.Cleanup(srv.Close)
+
+	c := newTestClient()
+	c.BaseURL = srv.URL
+	return c, &requests
+}
+
+func testRequest(t *testing.T, c *Client, method string) error {
+	t.Helper()
+
+	// A body checks that it is sent again with each attempt
+	var body interface{}
+	if method == "POST" {
+		body = map[string]string{"key": "value"}
+	}
+
+	req, err := c.buildRequest(context.Background(), method, "buildtargets", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result map[string]interface{}
+	_, err = c.doRequest(req, &result)
+	return err
+}
+
+func TestClientRetries(t *testing.T) {
+	cases := []struct {
+		Name               string
+		Method             string
+		Statuses           []int
+		RetryNonIdempotent bool
+		Requests           int32
+		Status             int
+	}{
+		{"server error", "GET", []int{500, 503}, false, 3, 0},
+		{"rate limited", "GET", []int{429}, false, 2, 0},
+		{"delete", "DELETE", []int{502}, false, 2, 0},
+		{"attempts exhausted", "GET", []int{500, 500, 500, 500}, false, 3, 500},
+		{"client error", "GET", []int{404}, false, 1, 404},
+		{"post", "POST", []int{503}, false, 1, 503},
+		{"post rate limited", "POST", []int{429}, false, 1, 429},
+		{"post retried", "POST", []int{503}, true, 2, 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			c, requests := retryServer(t, 0, tc.Statuses...)
+			c.Retry.RetryNonIdempotent = tc.RetryNonIdempotent
+
+			err := testRequest(t, c, tc.Method)
+
+			if n := atomic.LoadInt32(requests); n != tc.Requests {
+				t.Errorf("Expected %d requests, got %d", tc.Requests, n)
+			}
+
+			var apiErr *APIError
+			if tc.Status == 0 {
+				if err != nil {
+					t.Errorf("Expected success, got %v", err)
+				}
+			} else if !errors.As(err, &apiErr) || apiErr.StatusCode != tc.Status {
+				t.Errorf("Expected HTTP %d, got %v", tc.Status, err)
+			}
+		})
+	}
+}
+
+func TestClientHonorsRetryAfter(t *testing.T) {
+	c, requests := retryServer(t, 1, http.StatusTooManyRequests)
+
+	start := time.Now()
+	if err := testRequest(t, c, "GET"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := atomic.LoadInt32(requests); n != 2 {
+		t.Errorf("Expected 2 requests, got %d", n)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Expected to wait for Retry-After, retried after %v", elapsed)
+	}
+}
+
+func TestClientRetryAfterBeyondMaxDelay(t *testing.T) {
+	c, requests := retryServer(t, 120, http.StatusTooManyRequests)
+	c.Retry.MaxDelay = time.Minute
+
+	err := testRequest(t, c, "GET")
+
+	if n := atomic.LoadInt32(requests); n != 1 {
+		t.Errorf("Expected 1 request, got %d", n)
+	}
+	var apiErr *APIError
+	if !errors.Is(err, RateLimitedError) || !errors.As(err, &apiErr) || apiErr.RetryAfter != 2*time.Minute {
+		t.Errorf("Expected a rate limit error with Retry-After, got %v", err)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	cases := []struct {
+		Name     string
+		Attempt  int
+		Err      error
+		Min, Max time.Duration
+	}{
+		{"first", 1, errors.New("network"), time.Second / 2, time.Second},
+		{"second", 2, errors.New("network"), time.Second, 2 * time.Second},
+		{"capped", 6, errors.New("network"), 5 * time.Second / 2, 5 * time.Second},
+		{"retry after", 1, &APIError{StatusCode: 429, RetryAfter: 3 * time.Second}, 3 * time.Second, 3 * time.Second},
+		{"rate limit reset", 1, &APIError{StatusCode: 429, RateLimitReset: time.Now().Add(4 * time.Second)}, 3 * time.Second, 4 * time.Second},
+		{"reset passed", 1, &APIError{StatusCode: 429, RateLimitReset: time.Now().Add(-time.Second)}, time.Second / 2, time.Second},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			if d := policy.delay(tc.Attempt, tc.Err); d < tc.Min || d > tc.Max {
+				t.Errorf("Expected a delay between %v and %v, got %v", tc.Min, tc.Max, d)
+			}
+		})
+	}
+}
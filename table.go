@@ -0,0 +1,304 @@
+package unitycloudbuild
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type buildColumn struct {
+	Name   string
+	Header string
+	Value  func(target string, build *Build) string
+}
+
+type targetColumn struct {
+	Name   string
+	Header string
+	Value  func(target *BuildTarget) string
+}
+
+// buildColumns are the columns that can be selected when rendering builds as
+// a table or CSV.
+var buildColumns = []buildColumn{
+	{"target", "TARGET", func(target string, b *Build) string { return target }},
+	{"number", "BUILD", func(target string, b *Build) string { return strconv.Itoa(b.Number) }},
+	{"status", "STATUS", func(target string, b *Build) string { return b.Status }},
+	{"revision", "REVISION", func(target string, b *Build) string { return b.LastBuiltRevision }},
+	{"duration", "DURATION", func(target string, b *Build) string {
+		return (time.Second * time.Duration(b.TotalTimeSeconds)).String()
+	}},
+	{"unity", "UNITY", func(target string, b *Build) string {
+		return strings.Replace(b.UnityVersion, "_", ".", -1)
+	}},
+	{"created", "CREATED", func(target string, b *Build) string { return b.Created.Format(time.RFC3339) }},
+	{"finished", "FINISHED", func(target string, b *Build) string {
+		if b.Finished.IsZero() {
+			return ""
+		}
+		return b.Finished.Format(time.RFC3339)
+	}},
+	{"guid", "GUID", func(target string, b *Build) string { return b.GUID }},
+	{"platform", "PLATFORM", func(target string, b *Build) string { return b.Platform }},
+	{"branch", "BRANCH", func(target string, b *Build) string { return b.ScmBranch }},
+	{"download", "DOWNLOAD", func(target string, b *Build) string {
+		if b.Links.DownloadPrimary == nil {
+			return ""
+		}
+		return b.Links.DownloadPrimary.Href
+	}},
+}
+
+var defaultBuildColumns = []string{"target", "number", "status", "revision", "duration", "unity"}
+
+// targetColumns are the columns that can be selected when rendering build
+// targets as a table or CSV.
+var targetColumns = []targetColumn{
+	{"id", "ID", func(t *BuildTarget) string { return t.Id }},
+	{"name", "NAME", func(t *BuildTarget) string { return t.Name }},
+	{"platform", "PLATFORM", func(t *BuildTarget) string { return t.Platform }},
+	{"enabled", "ENABLED", func(t *BuildTarget) string { return strconv.FormatBool(t.Enabled) }},
+	{"autobuild", "AUTOBUILD", func(t *BuildTarget) string {
+		if t.Settings == nil {
+			return ""
+		}
+		return strconv.FormatBool(t.Settings.AutoBuild)
+	}},
+	{"branch", "BRANCH", func(t *BuildTarget) string {
+		if t.Settings == nil {
+			return ""
+		}
+		return t.Settings.Scm.Branch
+	}},
+	{"unity", "UNITY", func(t *BuildTarget) string {
+		if t.Settings == nil {
+			return ""
+		}
+		return strings.Replace(t.Settings.UnityVersion, "_", ".", -1)
+	}},
+}
+
+var defaultTargetColumns = []string{"id", "name", "enabled", "branch", "unity"}
+
+// TableRenderer writes aligned columns. Columns selects and orders the
+// columns by name, if empty the defaults for the data type are used.
+type TableRenderer struct {
+	Columns []string
+}
+
+func (r TableRenderer) Render(w io.Writer, v interface{}) error {
+	rows, err := tabulate(v, r.Columns)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// CSVRenderer writes a header row followed by one row per item. Columns
+// behaves the same as for TableRenderer.
+type CSVRenderer struct {
+	Columns []string
+}
+
+func (r CSVRenderer) Render(w io.Writer, v interface{}) error {
+	rows, err := tabulate(v, r.Columns)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// tabulate converts v into rows of strings, the first row being the headers.
+func tabulate(v interface{}, columns []string) ([][]string, error) {
+	switch v := v.(type) {
+	case Build:
+		return tabulateBuilds([]string{v.TargetId}, []*Build{&v}, columns)
+	case *Build:
+		return tabulateBuilds([]string{v.TargetId}, []*Build{v}, columns)
+	case []Build:
+		targets := make([]string, len(v))
+		builds := make([]*Build, len(v))
+		for i := range v {
+			targets[i] = v[i].TargetId
+			builds[i] = &v[i]
+		}
+		return tabulateBuilds(targets, builds, columns)
+	case *BuildAttempt:
+		return tabulate([]BuildAttempt{*v}, columns)
+	case []BuildAttempt:
+		targets := make([]string, len(v))
+		builds := make([]*Build, len(v))
+		for i := range v {
+			targets[i] = v[i].TargetId
+			builds[i] = &v[i].Build
+		}
+		return tabulateBuilds(targets, builds, columns)
+	case map[string]*Build:
+		targets := sortedBuildKeys(v)
+		builds := make([]*Build, len(targets))
+		for i, target := range targets {
+			builds[i] = v[target]
+		}
+		return tabulateBuilds(targets, builds, columns)
+	case []BuildTarget:
+		return tabulateTargets(v, columns)
+	case []Artifact:
+		rows := [][]string{{"ARTIFACT", "FILE", "SIZE"}}
+		for _, artifact := range v {
+			for _, file := range artifact.Files {
+				rows = append(rows, []string{artifact.Key, file.Filename, strconv.FormatInt(file.Size, 10)})
+			}
+		}
+		return rows, nil
+	case []DownloadedFile:
+		rows := [][]string{{"FILE", "TYPE", "SIZE", "ACTION", "PATH", "PACKAGE", "VERSION"}}
+		for _, file := range v {
+			var identifier, version string
+			if file.Package != nil {
+				identifier = file.Package.Identifier
+				version = file.Package.Version
+			}
+			rows = append(rows, []string{file.Filename, file.Type, strconv.FormatInt(file.Size, 10), string(file.Action), file.Path, identifier, version})
+		}
+		return rows, nil
+	case []TargetDownload:
+		rows := [][]string{{"TARGET", "NUMBER", "OUTPUT", "FILES", "ERROR"}}
+		for _, download := range v {
+			var number string
+			if download.Build != nil {
+				number = strconv.Itoa(download.Build.Number)
+			}
+			rows = append(rows, []string{download.TargetId, number, download.OutputDir, strconv.Itoa(len(download.Files)), download.Error})
+		}
+		return rows, nil
+	case []CacheEntry:
+		rows := [][]string{{"TARGET", "NUMBER", "GUID", "FILES", "SIZE", "LAST USED"}}
+		for _, entry := range v {
+			rows = append(rows, []string{entry.TargetId, strconv.Itoa(entry.BuildNumber), entry.GUID, strconv.Itoa(len(entry.Files)), strconv.FormatInt(entry.Size(), 10), entry.LastUsed.Format(time.RFC3339)})
+		}
+		return rows, nil
+	case *CacheSize:
+		return [][]string{{"DIR", "BUILDS", "FILES", "SIZE"}, {v.Dir, strconv.Itoa(v.Entries), strconv.Itoa(v.Files), strconv.FormatInt(v.Size, 10)}}, nil
+	case []BuildFailure:
+		rows := [][]string{{"KIND", "FILE", "LINE", "CODE", "MESSAGE"}}
+		for _, failure := range v {
+			line := ""
+			if failure.Line > 0 {
+				line = strconv.Itoa(failure.Line)
+			}
+			rows = append(rows, []string{string(failure.Kind), failure.File, line, failure.Code, failure.Message})
+		}
+		return rows, nil
+	case *GitCommit:
+		header := []string{"REVISION", "BRANCH", "TAGS", "AUTHOR", "TIME", "DIRTY"}
+		row := []string{v.Revision, v.Branch, strings.Join(v.Tags, " "), v.Author, v.Time.Format(time.RFC3339), strconv.FormatBool(v.Dirty)}
+		if v.TargetBranch != nil {
+			header = append(header, "REMOTE", "AHEAD", "BEHIND")
+			row = append(row, v.TargetBranch.Remote, strconv.Itoa(v.TargetBranch.Ahead), strconv.Itoa(v.TargetBranch.Behind))
+		}
+		header = append(header, "MESSAGE")
+		row = append(row, strings.TrimSpace(v.Message))
+		return [][]string{header, row}, nil
+	default:
+		return nil, fmt.Errorf("Cannot render %T as a table", v)
+	}
+}
+
+func tabulateBuilds(targets []string, builds []*Build, columns []string) ([][]string, error) {
+	if len(columns) == 0 {
+		columns = defaultBuildColumns
+	}
+
+	selected := make([]buildColumn, 0, len(columns))
+	for _, name := range columns {
+		column, ok := findBuildColumn(name)
+		if !ok {
+			return nil, fmt.Errorf("Unknown build column: %s", name)
+		}
+		selected = append(selected, column)
+	}
+
+	header := make([]string, len(selected))
+	for i, column := range selected {
+		header[i] = column.Header
+	}
+
+	rows := [][]string{header}
+	for i, build := range builds {
+		row := make([]string, len(selected))
+		for j, column := range selected {
+			// Targets without a build (e.g. from Builds_Latest) only show the target
+			if build != nil || column.Name == "target" {
+				row[j] = column.Value(targets[i], build)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func tabulateTargets(targets []BuildTarget, columns []string) ([][]string, error) {
+	if len(columns) == 0 {
+		columns = defaultTargetColumns
+	}
+
+	selected := make([]targetColumn, 0, len(columns))
+	for _, name := range columns {
+		column, ok := findTargetColumn(name)
+		if !ok {
+			return nil, fmt.Errorf("Unknown target column: %s", name)
+		}
+		selected = append(selected, column)
+	}
+
+	header := make([]string, len(selected))
+	for i, column := range selected {
+		header[i] = column.Header
+	}
+
+	rows := [][]string{header}
+	for i := range targets {
+		row := make([]string, len(selected))
+		for j, column := range selected {
+			row[j] = column.Value(&targets[i])
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func findBuildColumn(name string) (buildColumn, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, column := range buildColumns {
+		if column.Name == name {
+			return column, true
+		}
+	}
+	return buildColumn{}, false
+}
+
+func findTargetColumn(name string) (targetColumn, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, column := range targetColumns {
+		if column.Name == name {
+			return column, true
+		}
+	}
+	return targetColumn{}, false
+}
@@ -0,0 +1,117 @@
+package unitycloudbuild
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTableRenderer(t *testing.T) {
+	builds := testBuilds()
+
+	cases := []struct {
+		Name     string
+		Columns  []string
+		Value    interface{}
+		Expected string
+	}{
+		{"default columns", nil, builds, `
+TARGET   BUILD  STATUS   REVISION                                  DURATION  UNITY
+android  12     success  5c1d9e07a3c04f8be2f1c4a7e56b2d7f0b1e9a43  12m34s    2019.4.1f1
+ios      3      started                                            1m1s      2019.4.1f1
+`},
+		{"selected columns", []string{"number", " Target", "branch", "finished", "download"}, builds, `
+BUILD  TARGET   BRANCH       FINISHED              DOWNLOAD
+12     android  main         2020-03-04T05:18:41Z  https://example.com/android.apk
+3      ios      release/1.2
+`},
+		{"target without build", []string{"target", "status"}, map[string]*Build{"windows": nil, "android": &builds[0]}, `
+TARGET   STATUS
+android  success
+windows
+`},
+		{"targets", []string{"id", "enabled", "branch"}, []BuildTarget{{Id: "android", Enabled: true}, {Id: "ios"}}, `
+ID       ENABLED  BRANCH
+android  true
+ios      false
+`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			expected := strings.TrimPrefix(tc.Expected, "\n")
+			output := renderString(t, NewRenderer(OutputFormat_Table, tc.Columns), tc.Value)
+
+			// tabwriter pads all but the last cell of a row
+			var trimmed []string
+			for _, line := range strings.Split(output, "\n") {
+				trimmed = append(trimmed, strings.TrimRight(line, " "))
+			}
+			if output = strings.Join(trimmed, "\n"); output != expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", expected, output)
+			}
+		})
+	}
+}
+
+func TestCSVRenderer(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Columns  []string
+		Value    interface{}
+		Expected string
+	}{
+		{"default columns", nil, testBuilds(), `
+TARGET,BUILD,STATUS,REVISION,DURATION,UNITY
+android,12,success,5c1d9e07a3c04f8be2f1c4a7e56b2d7f0b1e9a43,12m34s,2019.4.1f1
+ios,3,started,,1m1s,2019.4.1f1
+`},
+		{"selected columns", []string{"target", "created", "guid"}, testBuilds(), `
+TARGET,CREATED,GUID
+android,2020-03-04T05:06:07Z,1b3c5e7a
+ios,2020-03-04T05:07:07Z,
+`},
+		{"quoting", nil, []BuildFailure{
+			{Kind: FailureKind_Compiler, File: "Assets/A.cs", Line: 3, Code: "CS1002", Message: "; expected, found \"}\""},
+			{Kind: FailureKind_Gradle, Message: "Execution failed\nfor task ':launcher:packageRelease'"},
+		}, `
+KIND,FILE,LINE,CODE,MESSAGE
+compiler,Assets/A.cs,3,CS1002,"; expected, found ""}"""
+gradle,,,,"Execution failed
+for task ':launcher:packageRelease'"
+`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			expected := strings.TrimPrefix(tc.Expected, "\n")
+			if output := renderString(t, NewRenderer(OutputFormat_CSV, tc.Columns), tc.Value); output != expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", expected, output)
+			}
+		})
+	}
+}
+
+func TestTableRendererErrors(t *testing.T) {
+	cases := map[string]struct {
+		Columns []string
+		Value   interface{}
+		Error   string
+	}{
+		"unknown build column":  {[]string{"target", "size"}, testBuilds(), "Unknown build column: size"},
+		"unknown target column": {[]string{"status"}, []BuildTarget{{Id: "android"}}, "Unknown target column: status"},
+		"unsupported type":      {nil, 42, "Cannot render int as a table"},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			for _, renderer := range []Renderer{TableRenderer{Columns: tc.Columns}, CSVRenderer{Columns: tc.Columns}} {
+				var b strings.Builder
+				if err := renderer.Render(&b, tc.Value); err == nil || err.Error() != tc.Error {
+					t.Errorf("%T: expected %q, got %v", renderer, tc.Error, err)
+				} else if b.Len() > 0 {
+					t.Errorf("%T: expected no output, got %q", renderer, b.String())
+				}
+			}
+		})
+	}
+}
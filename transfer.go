@@ -0,0 +1,287 @@
+package unitycloudbuild
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var contentRangeRegex = regexp.MustCompile(`^bytes (\d+)-\d+/(\d+|\*)$`)
+
+// unsatisfiedRangeRegex matches the Content-Range of a 416 response, which
+// carries the total size.
+var unsatisfiedRangeRegex = regexp.MustCompile(`^bytes \*/(\d+)$`)
+var md5ETagRegex = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+
+type downloadStatusError struct {
+	StatusCode int
+}
+
+func (e *downloadStatusError) Error() string {
+	return fmt.Sprintf("Could not download, got status code: %d", e.StatusCode)
+}
+
+// errFileLocked is returned by lockFile if another process holds the lock.
+var errFileLocked = errors.New("File is locked")
+
+// openPartFile opens the .part file of a download and locks it, so that a
+// concurrent download of the same file fails instead of writing to it. If the
+// file system does not support locking, the file is used without a lock.
+func (c *Client) openPartFile(partName string) (*os.File, error) {
+	file, err := os.OpenFile(partName, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lockFile(file); err == errFileLocked {
+		file.Close()
+		return nil, fmt.Errorf("%s is being downloaded by another process", partName)
+	} else if err != nil && c.Context.Verbose {
+		log.Printf("Could not lock %s: %v", partName, err)
+	}
+
+	return file, nil
+}
+
+type fetchResult struct {
+	Total int64
+	ETag  string
+}
+
+// fetchFile downloads a file to filename. Data is first written to a .part
+// file, interrupted transfers are resumed with HTTP Range requests, and the
+// result is verified against the expected size and MD5 (or ETag) before the
+// .part file is renamed.
+//
+// If resume is false the .part file is removed when the download fails,
+// otherwise it is kept so that a later call continues where this one stopped.
+func (c *Client) fetchFile(ctx context.Context, download downloadFile, filename string, resume bool, progress ProgressFunc) (err error) {
+	partName := filename + ".part"
+
+	file, err := c.openPartFile(partName)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+
+		var checksumErr *ChecksumError
+		if err != nil && (!resume || errors.As(err, &checksumErr)) {
+			os.Remove(partName)
+		}
+	}()
+
+	if !resume {
+		if err := file.Truncate(0); err != nil {
+			return err
+		}
+	}
+
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	if offset > 0 && c.Context.Verbose {
+		log.Printf("Resuming download of %s at %d bytes", download.Filename, offset)
+	}
+
+	var result fetchResult
+	for attempt := 1; ; attempt++ {
+		result, err = c.fetchRange(ctx, download, file, &offset, progress)
+		if err == nil {
+			break
+		}
+
+		var statusErr *downloadStatusError
+		if ctx.Err() != nil || attempt >= c.Retry.MaxAttempts || (errors.As(err, &statusErr) && statusErr.StatusCode < 500) {
+			return err
+		}
+
+		delay := c.Retry.delay(attempt, err)
+		if c.Context.Verbose {
+			log.Printf("Download interrupted at %d bytes, resuming in %v: %v", offset, delay, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+
+	if err := verifyDownload(file, download, offset, result); err != nil {
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+	file = nil
+
+	return os.Rename(partName, filename)
+}
+
+// fetchRange downloads from *offset to the end of the file, advancing *offset
+// as data is written.
+func (c *Client) fetchRange(ctx context.Context, download downloadFile, file *os.File, offset *int64, progress ProgressFunc) (fetchResult, error) {
+	var result fetchResult
+
+	if c.Context.Verbose {
+		// The query string of a download URL carries its signature
+		logURL := *download.URL
+		logURL.RawQuery = ""
+		log.Println(logURL.String())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", download.URL.String(), nil)
+	if err != nil {
+		return result, err
+	}
+
+	if *offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", *offset))
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	if c.Context.Verbose {
+		for name, val := range resp.Header {
+			log.Printf("Response header: %s=%s", name, val)
+		}
+	}
+
+	result.ETag = resp.Header.Get("ETag")
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// Range not supported or not requested, start over
+		if err := resetFile(file); err != nil {
+			return result, err
+		}
+		*offset = 0
+		result.Total = resp.ContentLength
+	case http.StatusPartialContent:
+		m := contentRangeRegex.FindStringSubmatch(resp.Header.Get("Content-Range"))
+		if m == nil {
+			return result, fmt.Errorf("Invalid Content-Range: %s", resp.Header.Get("Content-Range"))
+		} else if start, _ := strconv.ParseInt(m[1], 10, 64); start != *offset {
+			return result, fmt.Errorf("Server resumed at %d, expected %d", start, *offset)
+		}
+		result.Total = -1
+		if m[2] != "*" {
+			result.Total, _ = strconv.ParseInt(m[2], 10, 64)
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The .part file is already complete if it has the expected size,
+		// or the size the server reports if none is known
+		total := download.Size
+		if m := unsatisfiedRangeRegex.FindStringSubmatch(resp.Header.Get("Content-Range")); m != nil && total <= 0 {
+			total, _ = strconv.ParseInt(m[1], 10, 64)
+		}
+		if total > 0 && *offset == total {
+			result.Total = total
+			return result, nil
+		}
+		// Start over on the next attempt
+		resumeErr := fmt.Errorf("Could not resume download at %d bytes", *offset)
+		if err := resetFile(file); err != nil {
+			return result, err
+		}
+		*offset = 0
+		return result, resumeErr
+	default:
+		return result, &downloadStatusError{StatusCode: resp.StatusCode}
+	}
+
+	if _, err := file.Seek(*offset, io.SeekStart); err != nil {
+		return result, err
+	}
+
+	writer := newProgressWriter(file, progress, download.Filename, *offset, result.Total)
+	_, err = io.Copy(writer, resp.Body)
+	*offset = writer.downloaded
+	if err != nil {
+		return result, err
+	}
+
+	writer.report(true)
+	return result, nil
+}
+
+func resetFile(file *os.File) error {
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err := file.Seek(0, io.SeekStart)
+	return err
+}
+
+func verifyDownload(file *os.File, download downloadFile, size int64, result fetchResult) error {
+	expectedSize := download.Size
+	if expectedSize <= 0 {
+		expectedSize = result.Total
+	}
+
+	if expectedSize > 0 && size != expectedSize {
+		return &ChecksumError{Filename: download.Filename, Kind: "size", Expected: strconv.FormatInt(expectedSize, 10), Actual: strconv.FormatInt(size, 10)}
+	}
+
+	expectedMD5 := parseMD5(download.MD5)
+	if len(expectedMD5) == 0 {
+		// S3 uses the MD5 as ETag, unless the object was uploaded in parts
+		if etag := strings.Trim(result.ETag, `"`); md5ETagRegex.MatchString(etag) {
+			expectedMD5 = strings.ToLower(etag)
+		}
+	}
+
+	if len(expectedMD5) == 0 {
+		return nil
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return err
+	}
+
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expectedMD5 {
+		return &ChecksumError{Filename: download.Filename, Kind: "md5", Expected: expectedMD5, Actual: actual}
+	}
+
+	return nil
+}
+
+// parseMD5 accepts a hex or base64 encoded MD5 and returns it hex encoded.
+func parseMD5(s string) string {
+	if md5ETagRegex.MatchString(s) {
+		return strings.ToLower(s)
+	}
+
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil && len(b) == md5.Size {
+		return hex.EncodeToString(b)
+	}
+
+	return ""
+}
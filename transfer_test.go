@@ -0,0 +1,149 @@
+package unitycloudbuild
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient() *Client {
+	c := NewClient(&CloudBuildContext{OrgId: "org", ProjectId: "project", OutputFormat: OutputFormat_None})
+	c.Retry.MaxAttempts = 3
+	c.Retry.BaseDelay = time.Millisecond
+	return c
+}
+
+func testDownload(t *testing.T, srv *httptest.Server, size int64) downloadFile {
+	u, err := url.Parse(srv.URL + "/build.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return downloadFile{Filename: "build.zip", Type: "zip", URL: u, Size: size}
+}
+
+func testContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	return content
+}
+
+func TestFetchFileCompletePartWithUnknownSize(t *testing.T) {
+	content := testContent(1000)
+
+	var fullRequests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.Header.Get("Range")) == 0 {
+			atomic.AddInt32(&fullRequests, 1)
+		}
+		// Answers a range starting at the end with 416 and "bytes */1000"
+		http.ServeContent(w, r, "build.zip", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	filename := filepath.Join(t.TempDir(), "build.zip")
+	if err := ioutil.WriteFile(filename+".part", content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := newTestClient().fetchFile(context.Background(), testDownload(t, srv, 0), filename, true, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := atomic.LoadInt32(&fullRequests); n != 0 {
+		t.Errorf("Expected the complete .part to be kept, got %d full downloads", n)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("Downloaded content does not match")
+	}
+}
+
+func TestFetchFileLockedPart(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(testContent(100))
+	}))
+	defer srv.Close()
+
+	c := newTestClient()
+	filename := filepath.Join(t.TempDir(), "build.zip")
+
+	// Another download of the same file holds the lock
+	other, err := c.openPartFile(filename + ".part")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Write([]byte("partial")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, connections := range []int{1, 4} {
+		var err error
+		if connections == 1 {
+			err = c.fetchFile(context.Background(), testDownload(t, srv, 100), filename, false, nil)
+		} else {
+			err = c.fetchFileParallel(context.Background(), testDownload(t, srv, 100), filename, connections, true, nil)
+		}
+		if err == nil || !strings.Contains(err.Error(), "another process") {
+			t.Errorf("Expected the locked .part file to be refused with %d connections, got %v", connections, err)
+		}
+	}
+
+	if content, err := ioutil.ReadFile(filename + ".part"); err != nil || string(content) != "partial" {
+		t.Errorf("Expected the locked .part file to be left alone, got %q, %v", content, err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("Expected no requests, got %d", n)
+	}
+
+	// Once the other download stops, the file can be downloaded
+	other.Close()
+	if err := c.fetchFile(context.Background(), testDownload(t, srv, 100), filename, false, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFetchFileVerboseLogOmitsSignature(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testContent(100))
+	}))
+	defer srv.Close()
+
+	download := testDownload(t, srv, 100)
+	download.URL.RawQuery = "Expires=1591012800&Signature=s3cr3t"
+
+	c := newTestClient()
+	c.Context.Verbose = true
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	if err := c.fetchFile(context.Background(), download, filepath.Join(t.TempDir(), "build.zip"), false, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(logged.String(), srv.URL+"/build.zip") {
+		t.Errorf("Expected the download URL to be logged, got:\n%s", logged.String())
+	}
+	if strings.Contains(logged.String(), "s3cr3t") {
+		t.Errorf("Expected the signature not to be logged, got:\n%s", logged.String())
+	}
+}
@@ -74,18 +74,43 @@ type Link struct {
 }
 
 type File struct {
-	Filename string `json:"filename"`
-	Href     string `json:"href"`
-	Size     int64  `json:"size"`
+	Filename  string `json:"filename"`
+	Href      string `json:"href"`
+	Size      int64  `json:"size"`
+	MD5Sum    string `json:"md5sum,omitempty"`
+	Resumable bool   `json:"resumable,omitempty"`
 }
 
 type Artifact struct {
-	Files []File `json:"files,omitempty"`
-	Key   string `json:"key"`
-	Name  string `json:"name"`
+	Files   []File `json:"files,omitempty"`
+	Key     string `json:"key"`
+	Name    string `json:"name"`
+	Primary bool   `json:"primary,omitempty"`
 }
 
 type GitCommit struct {
-	Revision string `json:"revision"`
-	Message  string `json:"message,omitempty"`
+	Revision string    `json:"revision"`
+	Message  string    `json:"message,omitempty"`
+	Author   string    `json:"author,omitempty"`
+	Time     time.Time `json:"time"`
+
+	// Branch is empty if HEAD is detached.
+	Branch string   `json:"branch,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+
+	// Dirty is true if tracked files have uncommitted changes. It is false
+	// if the working tree could not be checked.
+	Dirty bool `json:"dirty"`
+
+	// TargetBranch is only set by Git_HeadForTarget.
+	TargetBranch *GitBranchStatus `json:"targetBranch,omitempty"`
+}
+
+// GitBranchStatus compares a commit to the remote tracking branch of a
+// branch, like git status does for the upstream branch.
+type GitBranchStatus struct {
+	Branch string `json:"branch"`
+	Remote string `json:"remote"`
+	Ahead  int    `json:"ahead"`
+	Behind int    `json:"behind"`
 }
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	cb "github.com/justonia/unitycloudbuild"
 	"github.com/urfave/cli"
@@ -17,6 +23,10 @@ const Version string = "0.2.3"
 func main() {
 	var apiKey string
 
+	// Cancel in-flight requests, waits and downloads on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	app := cli.NewApp()
 	app.Name = "unity-cb-tool"
 	app.Version = Version
@@ -40,12 +50,41 @@ func main() {
 		},
 		cli.BoolFlag{
 			Name:  "json",
-			Usage: "If true, output responses in JSON",
+			Usage: "If true, output responses in JSON (same as --format json)",
+		},
+		cli.StringFlag{
+			Name:  "format",
+			Usage: "Output format (human, json, yaml, table, csv)",
+			Value: "human",
+		},
+		cli.StringFlag{
+			Name:  "template",
+			Usage: "Go template used to output each item, e.g. '{{.TargetId}} #{{.Number}} {{.Status}}'. Overrides --format",
+		},
+		cli.StringFlag{
+			Name:  "columns",
+			Usage: "Comma separated columns for table and csv output. Builds: target, number, status, revision, duration, unity, created, finished, guid, platform, branch, download. Targets: id, name, platform, enabled, autobuild, branch, unity",
 		},
 		cli.BoolFlag{
 			Name:  "verbose",
 			Usage: "If true, output detailed status messages to log",
 		},
+		cli.StringFlag{
+			Name:   "api-url",
+			Usage:  "Cloud Build API base URL",
+			EnvVar: "UNITY_CLOUD_BUILD_API_URL",
+			Value:  cb.DefaultBaseURL,
+		},
+		cli.IntFlag{
+			Name:  "retries",
+			Usage: "Number of times to retry API requests that fail due to rate limiting or server errors",
+			Value: cb.DefaultRetryPolicy.MaxAttempts - 1,
+		},
+		cli.StringFlag{
+			Name:   "cache-dir",
+			Usage:  "Download cache directory (default: unity-cb-tool in the user cache directory, e.g. ~/.cache/unity-cb-tool)",
+			EnvVar: "UNITY_CLOUD_BUILD_CACHE_DIR",
+		},
 	}
 	app.Commands = []cli.Command{
 		{
@@ -74,10 +113,12 @@ func main() {
 						},
 					},
 					Action: func(c *cli.Context) error {
-						_, err := cb.Builds_List(
-							buildContext(c),
-							c.String("target-id"), c.String("filter-status"), c.String("filter-platform"), c.Int64("limit"))
-						return err
+						builds, err := buildClient(c).Builds_List(
+							ctx, c.String("target-id"), c.String("filter-status"), c.String("filter-platform"), c.Int64("limit"))
+						if err != nil {
+							return err
+						}
+						return render(c, builds)
 					},
 				},
 				{
@@ -104,8 +145,11 @@ func main() {
 							log.Fatal("missing build number")
 						}
 
-						_, err := cb.Builds_Status(buildContext(c), c.String("target-id"), c.Int64("build"))
-						return err
+						build, err := buildClient(c).Builds_Status(ctx, c.String("target-id"), c.Int64("build"))
+						if err != nil {
+							return err
+						}
+						return render(c, build)
 					},
 				},
 				{
@@ -122,8 +166,11 @@ func main() {
 						},
 					},
 					Action: func(c *cli.Context) error {
-						_, err := cb.Builds_Latest(buildContext(c), c.Bool("success"), c.Bool("only-enabled"))
-						return err
+						builds, err := buildClient(c).Builds_Latest(ctx, c.Bool("success"), c.Bool("only-enabled"))
+						if err != nil {
+							return err
+						}
+						return render(c, builds)
 					},
 				},
 				{
@@ -149,12 +196,12 @@ func main() {
 						var err error
 
 						if c.Bool("all") {
-							err = cb.Builds_CancelAll(buildContext(c), c.String("target-id"))
+							err = buildClient(c).Builds_CancelAll(ctx, c.String("target-id"))
 						} else {
 							if len(c.String("target-id")) == 0 {
 								log.Fatal("missing target-id")
 							}
-							err = cb.Builds_Cancel(buildContext(c), c.String("target-id"), c.Int64("build"))
+							err = buildClient(c).Builds_Cancel(ctx, c.String("target-id"), c.Int64("build"))
 						}
 						return err
 					},
@@ -162,44 +209,128 @@ func main() {
 				{
 					Name:  "start",
 					Usage: "Start a build for a build target, or if --all is specified start builds for all enabled targets",
-					Flags: []cli.Flag{
+					Flags: append([]cli.Flag{
 						cli.BoolFlag{
 							Name:  "all",
 							Usage: "If true, start builds on all enabled targets",
 						},
-						cli.BoolFlag{
-							Name:  "clean",
-							Usage: "Force a clean build.",
-						},
 						cli.StringFlag{
 							Name:  "target-id,t",
 							Usage: "Build target ID",
 							Value: "",
 						},
-					},
+						commitFlag,
+					}, startFlags...),
 					Action: func(c *cli.Context) error {
-						var err error
+						if c.Bool("all") {
+							attempts, err := buildClient(c).Builds_StartAll(ctx, startOptions(c))
+							if err != nil {
+								return err
+							}
+							return render(c, attempts)
+						}
+
+						if len(c.String("target-id")) == 0 {
+							log.Fatal("missing target-id")
+						}
 
+						attempt, err := buildClient(c).Builds_Start(ctx, c.String("target-id"), startOptions(c))
+						if err != nil {
+							return err
+						}
+						return render(c, attempt)
+					},
+				},
+				{
+					Name:  "run",
+					Usage: "Start a build for a build target, or if --all is specified for all enabled targets, wait for exactly those builds to finish and optionally download them",
+					Flags: append([]cli.Flag{
+						cli.StringFlag{
+							Name:  "target-id,t",
+							Usage: "Build target ID",
+							Value: "",
+						},
+						cli.BoolFlag{
+							Name:  "all",
+							Usage: "If true, start builds on all enabled targets",
+						},
+						cli.BoolFlag{
+							Name:  "download",
+							Usage: "If true, download the builds once they all succeeded",
+						},
+						cli.StringFlag{
+							Name:  "output,o",
+							Usage: "If set with --download, the builds are written to this directory. This is a template, e.g. 'dist/{{.TargetId}}'",
+						},
+						cli.BoolFlag{
+							Name:  "unzip",
+							Usage: "If true with --download, extract the contents of the builds to the output directory",
+						},
+						cli.BoolFlag{
+							Name:  "manifest",
+							Usage: "If true with --download, write build-manifest.json to the output directory",
+						},
+						commitFlag,
+					}, append(startFlags, waitFlags...)...),
+					Action: func(c *cli.Context) error {
 						if c.Bool("all") {
-							_, err = cb.Builds_StartAll(buildContext(c), c.Bool("clean"))
-						} else {
-							if len(c.String("target-id")) == 0 {
-								log.Fatal("missing target-id")
+							if len(c.String("target-id")) > 0 {
+								log.Fatal("--all and --target-id cannot be used together")
 							}
-							_, err = cb.Builds_Start(buildContext(c), c.String("target-id"), c.Bool("clean"))
+						} else if len(c.String("target-id")) == 0 {
+							log.Fatal("missing target-id")
 						}
-						return err
+
+						if !c.Bool("download") && (len(c.String("output")) > 0 || c.Bool("unzip") || c.Bool("manifest")) {
+							log.Fatal("--output, --unzip and --manifest require --download")
+						}
+
+						client := buildClient(c)
+
+						builds, err := client.Builds_Run(ctx, c.String("target-id"), c.Bool("all"), startOptions(c), waitOptions(c))
+						if err != nil {
+							return err
+						}
+
+						if !c.Bool("download") {
+							return renderBuilds(c, builds)
+						}
+
+						downloads, err := client.Builds_DownloadBuilds(ctx, builds, cb.DownloadAllOptions{
+							DownloadOptions: cb.DownloadOptions{
+								OutputDir: c.String("output"),
+								Unzip:     c.Bool("unzip"),
+								Manifest:  c.Bool("manifest"),
+							},
+						})
+						if err != nil {
+							return err
+						}
+
+						if err := render(c, downloads); err != nil {
+							return err
+						}
+						return downloadErrors(downloads)
 					},
 				},
 				{
 					Name:  "download",
-					Usage: "Download builds",
+					Usage: "Download a build, or if --all and --latest are specified the latest successful builds of all enabled targets",
 					Flags: []cli.Flag{
 						cli.StringFlag{
 							Name:  "target-id,t",
 							Usage: "Build target ID",
 							Value: "",
 						},
+						cli.BoolFlag{
+							Name:  "all",
+							Usage: "If true with --latest, download the latest successful build of all enabled targets",
+						},
+						cli.IntFlag{
+							Name:  "workers",
+							Value: cb.DefaultDownloadWorkers,
+							Usage: "Number of builds downloaded concurrently with --all",
+						},
 						cli.Int64Flag{
 							Name:  "build,b",
 							Usage: "Build number for build target",
@@ -211,28 +342,150 @@ func main() {
 						},
 						cli.StringFlag{
 							Name:  "output,o",
-							Usage: "If set, the build is written to this directory instead of the current directory",
+							Usage: "If set, the build is written to this directory instead of the current directory. With --all this is a template, e.g. 'dist/{{.TargetId}}'",
 						},
 						cli.BoolFlag{
 							Name:  "unzip",
-							Usage: "If true, unzip the contents of the build to the output directory. Only works with .zip builds (e.g. not .apk)",
+							Usage: "If true, extract the contents of the build to the output directory. Works with .zip and .tar.gz builds, mobile packages (.ipa, .apk, .aab) are saved and inspected",
+						},
+						cli.BoolFlag{
+							Name:  "clean-output",
+							Usage: "If true with --unzip and --output, remove the existing contents of the output directory before extracting. Git repositories and the current directory are never removed",
+						},
+						cli.StringFlag{
+							Name:  "artifact",
+							Usage: "If set, download the files of this artifact key instead of the primary download (see: builds artifacts list)",
+						},
+						cli.StringFlag{
+							Name:  "file",
+							Usage: "If set with --artifact, only download files matching this glob (e.g. '*.zip')",
+						},
+						cli.BoolFlag{
+							Name:  "resume",
+							Usage: "If true, keep partial downloads (.part files) on failure and resume them on the next run. Only single connection downloads are kept",
+						},
+						cli.BoolFlag{
+							Name:  "cache",
+							Usage: "If true, reuse builds from the download cache (see --cache-dir) and store downloaded builds in it",
+						},
+						cli.BoolFlag{
+							Name:  "manifest",
+							Usage: "If true, write build-manifest.json with the build details and SHA-256 of each file to the output directory",
+						},
+						cli.IntFlag{
+							Name:  "connections",
+							Value: 1,
+							Usage: "Number of parallel connections per file, requires range request support on the server",
 						},
 					},
 					Action: func(c *cli.Context) error {
+						options := cb.DownloadOptions{
+							Latest:      c.Bool("latest"),
+							OutputDir:   c.String("output"),
+							Unzip:       c.Bool("unzip"),
+							Clean:       c.Bool("clean-output"),
+							Artifact:    c.String("artifact"),
+							FileGlob:    c.String("file"),
+							Resume:      c.Bool("resume"),
+							CacheDir:    c.GlobalString("cache-dir"),
+							Manifest:    c.Bool("manifest"),
+							Connections: c.Int("connections"),
+						}
+
+						if c.Bool("clean-output") && len(c.String("output")) == 0 {
+							log.Fatal("--clean-output requires --output, it removes the existing contents of the output directory")
+						}
+
+						if c.Bool("cache") {
+							options.Cache = downloadCache(c)
+						}
+
+						if c.Bool("all") {
+							if !c.Bool("latest") {
+								log.Fatal("--all requires --latest")
+							} else if len(c.String("target-id")) > 0 {
+								log.Fatal("--all and --target-id cannot be used together")
+							}
+
+							downloads, err := buildClient(c).Builds_DownloadAll(ctx, cb.DownloadAllOptions{
+								DownloadOptions: options,
+								Workers:         c.Int("workers"),
+							})
+							if err != nil {
+								return err
+							}
+
+							if err := render(c, downloads); err != nil {
+								return err
+							}
+							return downloadErrors(downloads)
+						}
+
 						if len(c.String("target-id")) == 0 {
 							log.Fatal("missing target-id")
 						}
 
-						err := cb.Builds_Download(
-							buildContext(c),
-							c.String("target-id"), c.Int64("build"), c.Bool("latest"), c.String("output"), c.Bool("unzip"))
-						return err
+						files, err := buildClient(c).Builds_Download(ctx, c.String("target-id"), c.Int64("build"), options)
+						if err != nil {
+							return err
+						}
+
+						return render(c, files)
+					},
+				},
+				{
+					Name: "artifacts",
+					Subcommands: []cli.Command{
+						{
+							Name:  "list",
+							Usage: "List the artifacts and files of a build",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "target-id,t",
+									Usage: "Build target ID",
+									Value: "",
+								},
+								cli.Int64Flag{
+									Name:  "build,b",
+									Usage: "Build number for build target",
+									Value: -1,
+								},
+								cli.BoolFlag{
+									Name:  "latest",
+									Usage: "If true, list artifacts of the latest successful build",
+								},
+							},
+							Action: func(c *cli.Context) error {
+								if len(c.String("target-id")) == 0 {
+									log.Fatal("missing target-id")
+								}
+
+								client := buildClient(c)
+
+								buildNumber := c.Int64("build")
+								if c.Bool("latest") {
+									var err error
+									buildNumber, err = latestBuildNumber(ctx, client, c.String("target-id"), "success")
+									if err != nil {
+										return err
+									}
+								} else if buildNumber < 0 {
+									log.Fatal("missing build number")
+								}
+
+								artifacts, err := client.Builds_Artifacts(ctx, c.String("target-id"), buildNumber)
+								if err != nil {
+									return err
+								}
+								return render(c, artifacts)
+							},
+						},
 					},
 				},
 				{
 					Name:  "wait-for-complete",
 					Usage: "Wait for in-progress build(s) to finish",
-					Flags: []cli.Flag{
+					Flags: append([]cli.Flag{
 						cli.StringFlag{
 							Name:  "target-id,t",
 							Usage: "Build target ID",
@@ -247,11 +500,7 @@ func main() {
 							Name:  "all",
 							Usage: "If true, wait for all active builds for all enabled targets",
 						},
-						cli.BoolFlag{
-							Name:  "abort-on-fail",
-							Usage: "If true, and --all is specified, exit as soon as one build fails or is canceled.",
-						},
-					},
+					}, waitFlags...),
 					Action: func(c *cli.Context) error {
 						if !c.Bool("all") {
 							if len(c.String("target-id")) == 0 {
@@ -259,12 +508,98 @@ func main() {
 							}
 						}
 
-						err := cb.Builds_WaitForComplete(
-							buildContext(c),
-							c.String("target-id"), c.Int64("build"), c.Bool("all"), c.Bool("abort-on-fail"))
+						err := buildClient(c).Builds_WaitForComplete(
+							ctx, c.String("target-id"), c.Int64("build"), c.Bool("all"), waitOptions(c))
 						return err
 					},
 				},
+				{
+					Name:  "log",
+					Usage: "Output the log of a build",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "target-id,t",
+							Usage: "Build target ID",
+							Value: "",
+						},
+						cli.Int64Flag{
+							Name:  "build,b",
+							Usage: "Build number for build target, if not set the latest build is used",
+							Value: -1,
+						},
+						cli.BoolFlag{
+							Name:  "follow,f",
+							Usage: "If true, keep polling the log until the build finishes",
+						},
+						cli.BoolFlag{
+							Name:  "compact",
+							Usage: "If true, only output the important parts of the log",
+						},
+						cli.StringFlag{
+							Name:  "output,o",
+							Usage: "If set, the log is written to this file instead of stdout",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						if len(c.String("target-id")) == 0 {
+							log.Fatal("missing target-id")
+						}
+
+						client := buildClient(c)
+
+						buildNumber := c.Int64("build")
+						if buildNumber < 0 {
+							var err error
+							buildNumber, err = latestBuildNumber(ctx, client, c.String("target-id"), "")
+							if err != nil {
+								return err
+							}
+						}
+
+						out := os.Stdout
+						if len(c.String("output")) > 0 {
+							file, err := os.Create(c.String("output"))
+							if err != nil {
+								return err
+							}
+							defer file.Close()
+							out = file
+						}
+
+						return client.Builds_StreamLog(ctx, c.String("target-id"), buildNumber, c.Bool("compact"), c.Bool("follow"), out)
+					},
+				},
+				{
+					Name:  "failures",
+					Usage: "Analyze the log of a build for compiler errors, exceptions and platform build failures",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "target-id,t",
+							Usage: "Build target ID",
+							Value: "",
+						},
+						cli.Int64Flag{
+							Name:  "build,b",
+							Usage: "Build number for build target",
+							Value: -1,
+						},
+					},
+					Action: func(c *cli.Context) error {
+						if len(c.String("target-id")) == 0 {
+							log.Fatal("missing target-id")
+						}
+
+						if c.Int64("build") < 0 {
+							log.Fatal("missing build number")
+						}
+
+						failures, err := buildClient(c).Builds_Failures(ctx, c.String("target-id"), c.Int64("build"))
+						if err != nil {
+							return err
+						}
+						return render(c, failures)
+					},
+				},
 			},
 		},
 		{
@@ -275,8 +610,62 @@ func main() {
 					Usage: "List all build targets",
 					Flags: []cli.Flag{},
 					Action: func(c *cli.Context) error {
-						_, err := cb.Targets_List(buildContext(c))
-						return err
+						targets, err := buildClient(c).Targets_List(ctx)
+						if err != nil {
+							return err
+						}
+						return render(c, targets)
+					},
+				},
+			},
+		},
+		{
+			Name:  "cache",
+			Usage: "Manage the download cache used by builds download --cache",
+			Subcommands: []cli.Command{
+				{
+					Name:  "list",
+					Usage: "List cached builds, most recently used first",
+					Action: func(c *cli.Context) error {
+						entries, err := downloadCache(c).List()
+						if err != nil {
+							return err
+						}
+						return render(c, entries)
+					},
+				},
+				{
+					Name:  "size",
+					Usage: "Output the number of cached builds and their total size",
+					Action: func(c *cli.Context) error {
+						size, err := downloadCache(c).Size()
+						if err != nil {
+							return err
+						}
+						return render(c, size)
+					},
+				},
+				{
+					Name:  "prune",
+					Usage: "Remove cached builds that have not been used recently",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "older-than",
+							Usage: "Remove builds last used longer ago than this, e.g. 72h or 30d",
+							Value: "30d",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						olderThan, err := parseAge(c.String("older-than"))
+						if err != nil {
+							return err
+						}
+
+						pruned, err := downloadCache(c).Prune(olderThan)
+						if err != nil {
+							return err
+						}
+						return render(c, pruned)
 					},
 				},
 			},
@@ -286,16 +675,66 @@ func main() {
 			Subcommands: []cli.Command{
 				{
 					Name:  "head",
-					Usage: "Output current revision and commit message for HEAD",
+					Usage: "Output current revision, branch, tags, author and commit message for HEAD, and whether the working tree is dirty",
 					Flags: []cli.Flag{
 						cli.StringFlag{
 							Name:  "repo-path,p",
 							Usage: "If set, search for Git repo there instead of current working directory",
 						},
+						cli.StringFlag{
+							Name:  "target-id,t",
+							Usage: "If set, count the commits HEAD is ahead and behind the branch this target builds from",
+						},
 					},
 					Action: func(c *cli.Context) error {
-						_, err := cb.Git_Head(buildContext(c), c.String("repo-path"))
-						return err
+						client := buildClient(c)
+
+						var commit *cb.GitCommit
+						var err error
+						if len(c.String("target-id")) > 0 {
+							commit, err = client.Git_HeadForTarget(ctx, c.String("repo-path"), c.String("target-id"))
+						} else {
+							commit, err = client.Git_Head(c.String("repo-path"))
+						}
+						if err != nil {
+							return err
+						}
+						return render(c, commit)
+					},
+				},
+				{
+					Name:  "build-head",
+					Usage: "Start builds of the current HEAD revision, after checking it was pushed to the branch of each target, and wait for them to finish",
+					Flags: append([]cli.Flag{
+						cli.StringFlag{
+							Name:  "target-id,t",
+							Usage: "Build target ID",
+							Value: "",
+						},
+						cli.BoolFlag{
+							Name:  "all",
+							Usage: "If true, build all enabled targets",
+						},
+						cli.StringFlag{
+							Name:  "repo-path,p",
+							Usage: "If set, search for Git repo there instead of current working directory",
+						},
+					}, append(startFlags, waitFlags...)...),
+					Action: func(c *cli.Context) error {
+						if c.Bool("all") {
+							if len(c.String("target-id")) > 0 {
+								log.Fatal("--all and --target-id cannot be used together")
+							}
+						} else if len(c.String("target-id")) == 0 {
+							log.Fatal("missing target-id")
+						}
+
+						builds, err := buildClient(c).Git_BuildHead(
+							ctx, c.String("repo-path"), c.String("target-id"), c.Bool("all"), startOptions(c), waitOptions(c))
+						if err != nil {
+							return err
+						}
+						return renderBuilds(c, builds)
 					},
 				},
 				{
@@ -326,7 +765,7 @@ func main() {
 							log.Fatal("missing target-id")
 						}
 
-						matches, err := cb.Git_BuildsMatchHead(buildContext(c), c.String("repo-path"), c.String("target-id"), c.Int64("build"), c.Bool("all"))
+						matches, err := buildClient(c).Git_BuildsMatchHead(ctx, c.String("repo-path"), c.String("target-id"), c.Int64("build"), c.Bool("all"))
 						if err != nil {
 							return err
 						}
@@ -345,25 +784,183 @@ func main() {
 	}
 }
 
+// startFlags are shared by the commands that start builds, see startOptions.
+// Except for git build-head, they also take commitFlag.
+var startFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "clean",
+		Usage: "Force a clean build.",
+	},
+	cli.BoolFlag{
+		Name:  "headless",
+		Usage: "If true, start a headless build",
+	},
+	cli.StringFlag{
+		Name:  "label",
+		Usage: "If set, label the build(s) with this text on the dashboard",
+	},
+	cli.StringFlag{
+		Name:  "platform",
+		Usage: "If set, override the platform to build (ios, android, webgl, osx, win, win64, linux, ...)",
+	},
+}
+
+var commitFlag = cli.StringFlag{
+	Name:  "commit",
+	Usage: "If set, build this revision instead of the head of the target's branch",
+}
+
+func startOptions(c *cli.Context) cb.StartOptions {
+	return cb.StartOptions{
+		Clean:    c.Bool("clean"),
+		Commit:   c.String("commit"),
+		Headless: c.Bool("headless"),
+		Label:    c.String("label"),
+		Platform: c.String("platform"),
+	}
+}
+
+// waitFlags are shared by the commands that wait for builds, see waitOptions.
+var waitFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "abort-on-fail",
+		Usage: "If true, and --all is specified, exit as soon as one build fails or is canceled.",
+	},
+	cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "Fail if the build(s) have not finished within this time, e.g. 90m",
+	},
+	cli.DurationFlag{
+		Name:  "queue-timeout",
+		Usage: "Fail if a build has not started this long after it was queued",
+	},
+	cli.DurationFlag{
+		Name:  "stall-timeout",
+		Usage: "Fail if a build stays in the same status for this long",
+	},
+	cli.BoolFlag{
+		Name:  "cancel-on-timeout",
+		Usage: "If true, cancel the build(s) that exceeded a timeout",
+	},
+}
+
+func waitOptions(c *cli.Context) cb.WaitOptions {
+	return cb.WaitOptions{
+		AbortOnFail:     c.Bool("abort-on-fail"),
+		Timeout:         c.Duration("timeout"),
+		QueueTimeout:    c.Duration("queue-timeout"),
+		StallTimeout:    c.Duration("stall-timeout"),
+		CancelOnTimeout: c.Bool("cancel-on-timeout"),
+	}
+}
+
+// downloadErrors returns an error if any target failed to download.
+func downloadErrors(downloads []cb.TargetDownload) error {
+	failed := 0
+	for _, download := range downloads {
+		if len(download.Error) > 0 {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d targets failed to download", failed, len(downloads))
+	}
+	return nil
+}
+
+func buildClient(c *cli.Context) *cb.Client {
+	client := cb.NewClient(buildContext(c))
+	client.BaseURL = c.GlobalString("api-url")
+	client.Retry.MaxAttempts = c.GlobalInt("retries") + 1
+	return client
+}
+
+func downloadCache(c *cli.Context) *cb.DownloadCache {
+	cache, err := cb.NewDownloadCache(c.GlobalString("cache-dir"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return cache
+}
+
+// parseAge parses a duration, additionally accepting days, e.g. "30d".
+func parseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("Invalid duration: %s", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func latestBuildNumber(ctx context.Context, client *cb.Client, buildTargetId string, filterStatus string) (int64, error) {
+	builds, err := client.Builds_List(ctx, buildTargetId, filterStatus, "", 1)
+	if err != nil {
+		return 0, err
+	} else if len(builds) == 0 {
+		return 0, fmt.Errorf("No builds for target %s", buildTargetId)
+	}
+	return int64(builds[0].Number), nil
+}
+
+func renderBuilds(c *cli.Context, builds []*cb.Build) error {
+	values := make([]cb.Build, len(builds))
+	for i, build := range builds {
+		values[i] = *build
+	}
+	return render(c, values)
+}
+
+func outputFormat(c *cli.Context) cb.OutputFormat {
+	if c.GlobalBool("json") {
+		return cb.OutputFormat_JSON
+	}
+
+	format, err := cb.ParseOutputFormat(c.GlobalString("format"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return format
+}
+
+func render(c *cli.Context, v interface{}) error {
+	if tmpl := c.GlobalString("template"); len(tmpl) > 0 {
+		renderer, err := cb.NewTemplateRenderer(tmpl)
+		if err != nil {
+			return err
+		}
+		return renderer.Render(os.Stdout, v)
+	}
+
+	var columns []string
+	if len(c.GlobalString("columns")) > 0 {
+		columns = strings.Split(c.GlobalString("columns"), ",")
+	}
+
+	return cb.NewRenderer(outputFormat(c), columns).Render(os.Stdout, v)
+}
+
 func buildContext(c *cli.Context) *cb.CloudBuildContext {
 	apiKey := c.GlobalString("api-key")
 	if len(apiKey) == 0 {
 		log.Fatal("Missing api-key")
 	}
 
-	outputFormat := cb.OutputFormat_Human
-	if c.GlobalBool("json") {
-		outputFormat = cb.OutputFormat_JSON
-	}
-
 	context := &cb.CloudBuildContext{
 		OrgId:        c.GlobalString("org-id"),
 		ProjectId:    c.GlobalString("project-id"),
 		ApiKey:       apiKey,
-		OutputFormat: outputFormat,
+		OutputFormat: outputFormat(c),
 		Verbose:      c.GlobalBool("verbose"),
 	}
 
+	// Progress messages would be mixed into the output of the template
+	if len(c.GlobalString("template")) > 0 {
+		context.OutputFormat = cb.OutputFormat_None
+	}
+
 	tryFillFromProjectSettings(context)
 
 	if len(context.OrgId) == 0 {
@@ -0,0 +1,462 @@
+package unitycloudbuild
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+const (
+	DefaultPollInterval    = time.Second * 5
+	DefaultMaxPollInterval = time.Minute
+)
+
+type WatchOptions struct {
+	// PollInterval is the time between status requests, defaults to
+	// DefaultPollInterval. If Adaptive is set, it is the shortest interval.
+	PollInterval time.Duration
+
+	// Adaptive varies the time between polls: it grows while builds sit in
+	// the queue or are far from the duration of their target's last
+	// successful build, shrinks as they approach it, and grows further if
+	// needed to stay within the API rate limit.
+	Adaptive bool
+
+	// MaxPollInterval is the longest time between polls when Adaptive is
+	// set, unless the rate limit requires waiting longer. Defaults to
+	// DefaultMaxPollInterval.
+	MaxPollInterval time.Duration
+
+	// QueueTimeout, if set, sends BuildStalled for a build that has not
+	// started this long after it was created, i.e. is still queued or sent
+	// to a builder.
+	QueueTimeout time.Duration
+
+	// StallTimeout, if set, sends BuildStalled for a build that has stayed
+	// in the same status this long. For builds other than queued ones, the
+	// time spent in the status before watching started is not known, so it
+	// is counted from the start of watching.
+	StallTimeout time.Duration
+}
+
+// BuildEvent is sent by Watch and WatchFunc. It is one of BuildQueued,
+// StatusChanged, BuildStalled, BuildFinished or BuildFailed.
+type BuildEvent interface {
+	EventBuild() *Build
+}
+
+// BuildQueued is sent for a build that is queued when watching starts, or is
+// queued again later, e.g. after being restarted.
+type BuildQueued struct {
+	Build *Build
+}
+
+// StatusChanged is sent whenever the status of a build changes.
+type StatusChanged struct {
+	Build *Build
+	From  string
+	To    string
+}
+
+// BuildFinished is sent once a build has completed successfully.
+type BuildFinished struct {
+	Build *Build
+}
+
+// BuildFailed is sent once a build has stopped without success, i.e. its
+// status is failure, canceled or unknown.
+type BuildFailed struct {
+	Build *Build
+}
+
+// BuildStalled is sent when a build exceeds WatchOptions.QueueTimeout or
+// StallTimeout. It is sent once per status, the build is still watched
+// afterwards.
+type BuildStalled struct {
+	Build  *Build
+	Status string
+
+	// Duration is how long the build has been waiting to start if Queued is
+	// set, otherwise how long it has been in Status.
+	Duration time.Duration
+	Queued   bool
+}
+
+func (e BuildQueued) EventBuild() *Build   { return e.Build }
+func (e StatusChanged) EventBuild() *Build { return e.Build }
+func (e BuildStalled) EventBuild() *Build  { return e.Build }
+func (e BuildFinished) EventBuild() *Build { return e.Build }
+func (e BuildFailed) EventBuild() *Build   { return e.Build }
+
+// Watcher delivers the events of Watch.
+type Watcher struct {
+	// Events is closed once all builds have finished, the context is done or
+	// polling failed. Err then returns the reason, if any.
+	Events <-chan BuildEvent
+
+	err error
+}
+
+// Err returns the error that stopped the watcher, or nil if all builds
+// finished. It must only be called after Events has been closed.
+func (w *Watcher) Err() error {
+	return w.err
+}
+
+// Watch polls the status of builds in the background and sends an event for
+// every transition. Builds that are not active when watching starts only get
+// their final BuildFinished or BuildFailed event.
+func (c *Client) Watch(ctx context.Context, builds []*Build, options WatchOptions) *Watcher {
+	events := make(chan BuildEvent)
+	watcher := &Watcher{Events: events}
+
+	go func() {
+		defer close(events)
+
+		watcher.err = c.WatchFunc(ctx, builds, options, func(event BuildEvent) error {
+			select {
+			case events <- event:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	return watcher
+}
+
+// WatchFunc is like Watch, but calls fn with each event and blocks until all
+// builds have finished. If fn returns an error, watching stops and WatchFunc
+// returns it.
+func (c *Client) WatchFunc(ctx context.Context, builds []*Build, options WatchOptions, fn func(BuildEvent) error) error {
+	pollInterval := options.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = DefaultPollInterval
+	}
+
+	current := make([]*Build, len(builds))
+	copy(current, builds)
+
+	finished := make([]bool, len(current))
+	remaining := len(current)
+
+	// When each build entered its current status, and whether BuildStalled
+	// was sent for it
+	since := make([]time.Time, len(current))
+	stalled := make([]bool, len(current))
+
+	for i, build := range current {
+		since[i] = time.Now()
+		if build.Status == "queued" && !build.Created.IsZero() {
+			since[i] = build.Created
+		}
+
+		var event BuildEvent
+		if !IsBuildActive(build) {
+			event = finishedEvent(build)
+			finished[i] = true
+			remaining--
+		} else if build.Status == "queued" {
+			event = BuildQueued{Build: build}
+		} else {
+			continue
+		}
+
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+
+	// Expected build durations by target, from their last successful build
+	var expected map[string]time.Duration
+	if options.Adaptive && remaining > 0 {
+		expected = c.expectedDurations(ctx)
+	}
+
+	// Requests made by the last poll, to estimate those of the next one
+	requests := 0
+
+	for remaining > 0 {
+		if err := checkStalled(current, finished, since, stalled, options, fn); err != nil {
+			return err
+		}
+
+		interval := pollInterval
+		if options.Adaptive {
+			interval = c.adaptivePollInterval(current, finished, expected, requests, options)
+		}
+
+		// Poll in time to notice stalled builds
+		for i, build := range current {
+			if finished[i] || stalled[i] {
+				continue
+			}
+			if start, timeout, _ := stallTimeout(build, since[i], options); timeout > 0 {
+				if untilStalled := time.Until(start.Add(timeout)); untilStalled < interval {
+					interval = untilStalled
+				}
+			}
+		}
+
+		if c.Context.Verbose {
+			log.Printf("Next poll in %v", interval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+
+		if c.Context.Verbose {
+			log.Print("Polling...")
+		}
+
+		updatedBuilds, polled, err := c.pollBuilds(ctx, current, finished)
+		requests = polled
+		if errors.Is(err, RateLimitedError) {
+			// Retries were exhausted, handle what was polled and try the
+			// rest again on the next poll.
+			if c.Context.Verbose {
+				log.Print("Rate limit hit, backing off until next poll")
+			}
+		} else if err != nil {
+			return err
+		}
+
+		for i, updatedBuild := range updatedBuilds {
+			if updatedBuild == nil {
+				continue
+			}
+
+			build := current[i]
+			current[i] = updatedBuild
+
+			var events []BuildEvent
+			if updatedBuild.Status != build.Status {
+				since[i] = time.Now()
+				stalled[i] = false
+
+				events = append(events, StatusChanged{Build: updatedBuild, From: build.Status, To: updatedBuild.Status})
+				if updatedBuild.Status == "queued" {
+					events = append(events, BuildQueued{Build: updatedBuild})
+				}
+			}
+
+			if !IsBuildActive(updatedBuild) {
+				events = append(events, finishedEvent(updatedBuild))
+				finished[i] = true
+				remaining--
+			}
+
+			for _, event := range events {
+				if err := fn(event); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// pollBuilds returns the current state of the unfinished builds, nil for the
+// others. If more than one build is unfinished, the most recent builds of all
+// targets are requested at once, and only builds missing from that list are
+// requested individually. The number of requests made is returned along with
+// the builds. On error, the builds polled so far are returned.
+func (c *Client) pollBuilds(ctx context.Context, builds []*Build, finished []bool) ([]*Build, int, error) {
+	updated := make([]*Build, len(builds))
+	requests := 0
+
+	var pending []int
+	for i := range builds {
+		if !finished[i] {
+			pending = append(pending, i)
+		}
+	}
+
+	if len(pending) > 1 {
+		recentBuilds, err := c.Builds_List(ctx, "_all", "", "", 0)
+		requests++
+		if err != nil {
+			return updated, requests, err
+		}
+
+		recent := make(map[string]*Build, len(recentBuilds))
+		for i := range recentBuilds {
+			recent[recentBuilds[i].UniqueId()] = &recentBuilds[i]
+		}
+
+		var missing []int
+		for _, i := range pending {
+			if build, ok := recent[builds[i].UniqueId()]; ok {
+				updated[i] = build
+			} else {
+				missing = append(missing, i)
+			}
+		}
+		pending = missing
+	}
+
+	for _, i := range pending {
+		build, err := c.Builds_Status(ctx, builds[i].TargetId, int64(builds[i].Number))
+		requests++
+		if err != nil {
+			return updated, requests, err
+		}
+		updated[i] = build
+	}
+
+	return updated, requests, nil
+}
+
+// expectedDurations returns the total time of the last successful build of
+// each target. Errors are only logged, as the durations are just a hint.
+func (c *Client) expectedDurations(ctx context.Context) map[string]time.Duration {
+	expected := make(map[string]time.Duration)
+
+	latest, err := c.Builds_Latest(ctx, true, false)
+	if err != nil {
+		if c.Context.Verbose {
+			log.Printf("Could not get previous build durations: %v", err)
+		}
+		return expected
+	}
+
+	for targetId, build := range latest {
+		if build != nil && build.TotalTimeSeconds > 0 {
+			expected[targetId] = time.Duration(build.TotalTimeSeconds * float64(time.Second))
+		}
+	}
+
+	return expected
+}
+
+// adaptivePollInterval picks the time until the next poll, see
+// WatchOptions.Adaptive. lastRequests is the number of requests made by the
+// previous poll, 0 if there was none.
+func (c *Client) adaptivePollInterval(builds []*Build, finished []bool, expected map[string]time.Duration, lastRequests int, options WatchOptions) time.Duration {
+	minInterval := options.PollInterval
+	if minInterval <= 0 {
+		minInterval = DefaultPollInterval
+	}
+	maxInterval := options.MaxPollInterval
+	if maxInterval <= 0 {
+		maxInterval = DefaultMaxPollInterval
+	}
+	if maxInterval < minInterval {
+		maxInterval = minInterval
+	}
+
+	interval := maxInterval
+
+	for i, build := range builds {
+		if finished[i] {
+			continue
+		}
+
+		var elapsed time.Duration
+		if !build.Created.IsZero() {
+			elapsed = time.Since(build.Created)
+		}
+
+		// The longer a build has been queued or running without an
+		// estimate, the less likely it is to finish in the next few seconds
+		d := elapsed / 10
+
+		if duration, ok := expected[build.TargetId]; ok && build.Status != "queued" {
+			// Poll more often as the expected completion approaches
+			d = (duration - elapsed) / 4
+		}
+
+		if d < minInterval {
+			d = minInterval
+		}
+		if d < interval {
+			interval = d
+		}
+	}
+
+	// Stay within the rate limit until it resets. Several builds are polled
+	// with a single request, plus one for each build missing from its
+	// response, so the next poll is assumed to cost as much as the last one.
+	// Before the first poll, all builds are assumed to be in the response.
+	requests := lastRequests
+	if requests < 1 {
+		requests = 1
+	}
+
+	if rateLimit := c.RateLimit(); rateLimit.Remaining >= 0 && rateLimit.Reset.After(time.Now()) {
+		untilReset := time.Until(rateLimit.Reset)
+
+		var needed time.Duration
+		if rateLimit.Remaining <= requests {
+			needed = untilReset
+		} else {
+			needed = untilReset * time.Duration(requests) / time.Duration(rateLimit.Remaining)
+		}
+
+		if needed > interval {
+			if c.Context.Verbose {
+				log.Printf("%d requests left until %v, slowing down", rateLimit.Remaining, rateLimit.Reset)
+			}
+			interval = needed
+		}
+	}
+
+	return interval
+}
+
+// checkStalled sends BuildStalled for unfinished builds that exceeded their
+// queue or stall timeout.
+func checkStalled(builds []*Build, finished []bool, since []time.Time, stalled []bool, options WatchOptions, fn func(BuildEvent) error) error {
+	for i, build := range builds {
+		if finished[i] || stalled[i] {
+			continue
+		}
+
+		start, timeout, queued := stallTimeout(build, since[i], options)
+		if timeout <= 0 || time.Since(start) < timeout {
+			continue
+		}
+
+		stalled[i] = true
+
+		event := BuildStalled{Build: build, Status: build.Status, Duration: time.Since(start), Queued: queued}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stallTimeout returns the timeout that applies to a build which entered its
+// status at since, and the time it counts from. Whichever of the queue and
+// stall timeouts expires first applies.
+func stallTimeout(build *Build, since time.Time, options WatchOptions) (time.Time, time.Duration, bool) {
+	start, timeout, queued := since, options.StallTimeout, false
+
+	if options.QueueTimeout > 0 && (build.Status == "queued" || build.Status == "sentToBuilder") {
+		created := build.Created
+		if created.IsZero() {
+			created = since
+		}
+
+		if timeout <= 0 || created.Add(options.QueueTimeout).Before(start.Add(timeout)) {
+			start, timeout, queued = created, options.QueueTimeout, true
+		}
+	}
+
+	return start, timeout, queued
+}
+
+func finishedEvent(build *Build) BuildEvent {
+	if build.Status == "success" {
+		return BuildFinished{Build: build}
+	}
+	return BuildFailed{Build: build}
+}
@@ -0,0 +1,335 @@
+package unitycloudbuild
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAPI serves the build status endpoints. Each build answers with the
+// next of its scripted statuses whenever it is polled, and keeps the last one.
+type fakeAPI struct {
+	mu       sync.Mutex
+	statuses map[string][]string
+
+	// hidden builds are left out of the listing of all targets
+	hidden map[string]bool
+
+	// cancelStatus is the status code DELETE answers with, 204 if unset
+	cancelStatus int
+
+	requests []string
+}
+
+func newFakeAPI(t *testing.T) (*fakeAPI, *Client) {
+	api := &fakeAPI{statuses: make(map[string][]string), hidden: make(map[string]bool)}
+
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+
+	c := newTestClient()
+	c.BaseURL = srv.URL
+	return api, c
+}
+
+// script sets the statuses a build reports on successive polls.
+func (a *fakeAPI) script(targetId string, number int, statuses ...string) *Build {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	build := &Build{TargetId: targetId, Number: number, Status: "queued"}
+	a.statuses[build.UniqueId()] = statuses
+	return build
+}
+
+func (a *fakeAPI) poll(targetId string, number int) Build {
+	build := Build{TargetId: targetId, Number: number}
+	statuses := a.statuses[build.UniqueId()]
+	build.Status = statuses[0]
+	if len(statuses) > 1 {
+		a.statuses[build.UniqueId()] = statuses[1:]
+	}
+	return build
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/orgs/org/projects/project/")
+	a.requests = append(a.requests, r.Method+" "+path)
+	parts := strings.Split(path, "/")
+
+	var result interface{}
+	switch {
+	case r.Method == "GET" && path == "buildtargets":
+		result = []BuildTarget{}
+	case r.Method == "GET" && path == "buildtargets/_all/builds":
+		var builds []Build
+		for id := range a.statuses {
+			if a.hidden[id] {
+				continue
+			}
+			i := strings.LastIndex(id, "-#")
+			number, _ := strconv.Atoi(id[i+2:])
+			builds = append(builds, a.poll(id[:i], number))
+		}
+		result = builds
+	case len(parts) == 4:
+		number, _ := strconv.Atoi(parts[3])
+		if r.Method == "DELETE" {
+			if a.cancelStatus != 0 {
+				http.Error(w, `{"error":"cannot cancel"}`, a.cancelStatus)
+			} else {
+				w.WriteHeader(http.StatusNoContent)
+			}
+			return
+		}
+		result = a.poll(parts[1], number)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+func (a *fakeAPI) requestLog() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.requests...)
+}
+
+func eventString(event BuildEvent) string {
+	build := event.EventBuild()
+	switch event := event.(type) {
+	case BuildQueued:
+		return "queued"
+	case StatusChanged:
+		return event.From + "->" + event.To
+	case BuildStalled:
+		return fmt.Sprintf("stalled %s", event.Status)
+	case BuildFinished:
+		return "finished"
+	case BuildFailed:
+		return "failed " + build.Status
+	}
+	return fmt.Sprintf("%T", event)
+}
+
+// watchEvents runs WatchFunc and returns the events of each build.
+func watchEvents(t *testing.T, c *Client, builds []*Build, options WatchOptions) map[string][]string {
+	t.Helper()
+
+	events := make(map[string][]string)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := c.WatchFunc(ctx, builds, options, func(event BuildEvent) error {
+		id := event.EventBuild().UniqueId()
+		events[id] = append(events[id], eventString(event))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func expectEvents(t *testing.T, events map[string][]string, expected map[string][]string) {
+	t.Helper()
+	for id, want := range expected {
+		if got := strings.Join(events[id], ", "); got != strings.Join(want, ", ") {
+			t.Errorf("Expected events of %s to be [%s], got [%s]", id, strings.Join(want, ", "), got)
+		}
+	}
+}
+
+func TestWatchFuncEvents(t *testing.T) {
+	api, c := newFakeAPI(t)
+	builds := []*Build{
+		api.script("android", 1, "started", "started", "success"),
+		api.script("ios", 2, "sentToBuilder", "started", "failure"),
+		api.script("webgl", 3, "restarted", "queued", "started", "canceled"),
+	}
+	done := &Build{TargetId: "linux", Number: 4, Status: "success"}
+
+	events := watchEvents(t, c, append(builds, done), WatchOptions{PollInterval: time.Millisecond})
+
+	expectEvents(t, events, map[string][]string{
+		"android-#1": {"queued", "queued->started", "started->success", "finished"},
+		"ios-#2":     {"queued", "queued->sentToBuilder", "sentToBuilder->started", "started->failure", "failed failure"},
+		"webgl-#3":   {"queued", "queued->restarted", "restarted->queued", "queued", "queued->started", "started->canceled", "failed canceled"},
+		"linux-#4":   {"finished"},
+	})
+}
+
+func TestWatchFuncPollsMissingBuildsIndividually(t *testing.T) {
+	api, c := newFakeAPI(t)
+	builds := []*Build{
+		api.script("android", 1, "started", "success"),
+		api.script("ios", 2, "started", "success"),
+		api.script("windows", 3, "started", "success"),
+	}
+	api.hidden["windows-#3"] = true
+
+	events := watchEvents(t, c, builds, WatchOptions{PollInterval: time.Millisecond})
+
+	for _, build := range builds {
+		if got := events[build.UniqueId()]; len(got) == 0 || got[len(got)-1] != "finished" {
+			t.Errorf("Expected %s to finish, got %v", build.UniqueId(), got)
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, request := range api.requestLog() {
+		counts[request]++
+	}
+	if counts["GET buildtargets/_all/builds"] != 2 {
+		t.Errorf("Expected 2 polls of all targets, got %v", counts)
+	}
+	if counts["GET buildtargets/windows/builds/3"] != 2 {
+		t.Errorf("Expected windows #3 to be polled on its own twice, got %v", counts)
+	}
+	if counts["GET buildtargets/android/builds/1"] != 0 || counts["GET buildtargets/ios/builds/2"] != 0 {
+		t.Errorf("Expected builds in the listing not to be polled on their own, got %v", counts)
+	}
+}
+
+func TestPollBuildsCountsRequests(t *testing.T) {
+	api, c := newFakeAPI(t)
+	builds := []*Build{
+		api.script("android", 1, "started"),
+		api.script("ios", 2, "started"),
+		api.script("windows", 3, "started"),
+	}
+	api.hidden["windows-#3"] = true
+
+	updated, requests, err := c.pollBuilds(context.Background(), builds, []bool{false, false, false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected the listing and one fallback request, got %d", requests)
+	}
+	for i, build := range updated {
+		if build == nil || build.Status != "started" {
+			t.Errorf("Expected build %d to be polled, got %+v", i, build)
+		}
+	}
+
+	// A single unfinished build is polled on its own
+	if _, requests, err = c.pollBuilds(context.Background(), builds, []bool{true, false, true}); err != nil {
+		t.Fatal(err)
+	} else if requests != 1 {
+		t.Errorf("Expected one request, got %d", requests)
+	}
+}
+
+func TestWatchFuncStalled(t *testing.T) {
+	api, c := newFakeAPI(t)
+	build := api.script("android", 1, "started", "started", "started", "success")
+	build.Status = "started"
+
+	var stalled []BuildStalled
+	err := c.WatchFunc(context.Background(), []*Build{build}, WatchOptions{PollInterval: 20 * time.Millisecond, StallTimeout: 30 * time.Millisecond}, func(event BuildEvent) error {
+		if event, ok := event.(BuildStalled); ok {
+			stalled = append(stalled, event)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sent once for the status, while the build is still watched until it
+	// finishes
+	if len(stalled) != 1 || stalled[0].Status != "started" || stalled[0].Queued {
+		t.Errorf("Expected one BuildStalled for started, got %+v", stalled)
+	}
+}
+
+func TestAdaptivePollInterval(t *testing.T) {
+	options := WatchOptions{PollInterval: time.Second, MaxPollInterval: time.Minute}
+	now := time.Now()
+
+	cases := []struct {
+		Name     string
+		Build    Build
+		Expected map[string]time.Duration
+		Interval time.Duration
+	}{
+		{"just queued", Build{TargetId: "android", Status: "queued", Created: now}, nil, time.Second},
+		{"queued for a while", Build{TargetId: "android", Status: "queued", Created: now.Add(-5 * time.Minute)}, nil, 30 * time.Second},
+		{"queued for long", Build{TargetId: "android", Status: "queued", Created: now.Add(-time.Hour)}, nil, time.Minute},
+		{"far from expected", Build{TargetId: "android", Status: "started", Created: now.Add(-time.Minute)}, map[string]time.Duration{"android": 3 * time.Minute}, 30 * time.Second},
+		{"near expected", Build{TargetId: "android", Status: "started", Created: now.Add(-10 * time.Minute)}, map[string]time.Duration{"android": 10*time.Minute + 2*time.Second}, time.Second},
+		{"past expected", Build{TargetId: "android", Status: "started", Created: now.Add(-20 * time.Minute)}, map[string]time.Duration{"android": 10 * time.Minute}, time.Second},
+		{"queued with expected", Build{TargetId: "android", Status: "queued", Created: now.Add(-5 * time.Minute)}, map[string]time.Duration{"android": 5*time.Minute + time.Second}, 30 * time.Second},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			interval := newTestClient().adaptivePollInterval([]*Build{&tc.Build}, []bool{false}, tc.Expected, 0, options)
+
+			// Allow for the time passed since now
+			if diff := interval - tc.Interval; diff < -time.Second/10 || diff > time.Second/10 {
+				t.Errorf("Expected an interval of %v, got %v", tc.Interval, interval)
+			}
+		})
+	}
+
+	t.Run("shortest of several", func(t *testing.T) {
+		builds := []*Build{
+			{TargetId: "android", Status: "queued", Created: now.Add(-time.Hour)},
+			{TargetId: "ios", Status: "queued", Created: now.Add(-100 * time.Second)},
+			{TargetId: "webgl", Status: "queued", Created: now},
+		}
+		interval := newTestClient().adaptivePollInterval(builds, []bool{false, false, true}, nil, 0, options)
+		if interval < 9*time.Second || interval > 11*time.Second {
+			t.Errorf("Expected an interval of 10s, got %v", interval)
+		}
+	})
+}
+
+func TestAdaptivePollIntervalRateLimit(t *testing.T) {
+	options := WatchOptions{PollInterval: time.Second, MaxPollInterval: time.Minute}
+	build := &Build{TargetId: "android", Status: "queued", Created: time.Now()}
+
+	cases := []struct {
+		Name         string
+		Remaining    int
+		Reset        time.Duration
+		LastRequests int
+		Interval     time.Duration
+	}{
+		{"plenty left", 1000, time.Minute, 1, time.Second},
+		{"spread until reset", 10, 100 * time.Second, 1, 10 * time.Second},
+		{"first poll", 10, 100 * time.Second, 0, 10 * time.Second},
+		{"fallback requests", 10, 100 * time.Second, 4, 40 * time.Second},
+		{"beyond max interval", 2, 100 * time.Second, 1, 50 * time.Second},
+		{"too few left", 3, 2 * time.Minute, 3, 2 * time.Minute},
+		{"exhausted", 0, 90 * time.Second, 1, 90 * time.Second},
+		{"already reset", 0, -time.Second, 1, time.Second},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			c := newTestClient()
+			c.rateLimit = RateLimit{Remaining: tc.Remaining, Reset: time.Now().Add(tc.Reset)}
+			c.rateLimitKnown = true
+
+			interval := c.adaptivePollInterval([]*Build{build}, []bool{false}, nil, tc.LastRequests, options)
+			if diff := interval - tc.Interval; diff < -time.Second/10 || diff > time.Second/10 {
+				t.Errorf("Expected an interval of %v, got %v", tc.Interval, interval)
+			}
+		})
+	}
+}